@@ -0,0 +1,429 @@
+// Command headless runs the visualiser without a gui, for machines with no
+// display. The colours are sent to the udp outputs given on the command line
+// until the process receives SIGINT or SIGTERM, when the outputs are blacked
+// out before exiting. Writing the name of a preset to stdin switches to it
+// without restarting the audio stream
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"github.com/nadav-rahimi/led-colour-visualiser"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// Collects the outputs given with repeated -output flags
+type outputFlags []lcv.OutputTarget
+
+func (o *outputFlags) String() string {
+	addrs := make([]string, len(*o))
+	for i, t := range *o {
+		addrs[i] = t.Name + "=" + t.Address
+	}
+	return strings.Join(addrs, ",")
+}
+
+// Parses an output of the form "[name=]host:port"
+func (o *outputFlags) Set(v string) error {
+	t := lcv.OutputTarget{Address: v, Enabled: true}
+	if i := strings.Index(v, "="); i != -1 {
+		t.Name, t.Address = v[:i], v[i+1:]
+	}
+	if t.Name == "" {
+		t.Name = t.Address
+	}
+	*o = append(*o, t)
+	return nil
+}
+
+// The settings given on the command line, kept apart from the config so they
+// can be applied on top of every config which is loaded
+type settingFlags struct {
+	device      string
+	gradient    string
+	smooth      bool
+	smoothAlpha float64
+	damp        bool
+	dampLength  int
+	highPass    float64
+	hum         float64
+	bandLow     float64
+	bandHigh    float64
+	outputs     outputFlags
+	sampleRate  float64
+	decimation  int
+	brightness  float64
+	graph       bool
+	spectrogram bool
+	// The names of the flags which were given, set once after parsing
+	given map[string]bool
+}
+
+// Defines the flags of the settings, with the settings of cfg as defaults
+func (s *settingFlags) define(cfg lcv.Config) {
+	flag.StringVar(&s.device, "device", cfg.InputDevice, "start of the name of the input device, the default device is used if empty")
+	flag.StringVar(&s.gradient, "gradient", cfg.Gradient, "name of the gradient used to colour the audio")
+	flag.BoolVar(&s.smooth, "smooth", cfg.Filter.Smooth, "smooth the detected frequency")
+	flag.Float64Var(&s.smoothAlpha, "smooth-alpha", cfg.Filter.SmoothAlpha, "weight of the old frequency when smoothing, in the range [0, 1]")
+	flag.BoolVar(&s.damp, "damp", cfg.Filter.Damp, "damp the detected frequency")
+	flag.IntVar(&s.dampLength, "damp-length", cfg.Filter.DampLength, "number of past frequencies averaged when damping")
+	flag.Float64Var(&s.highPass, "highpass", cfg.Filter.HighPassF, "cutoff of the high-pass filter applied to the input in Hz, 0 disables it")
+	flag.Float64Var(&s.hum, "hum", cfg.Filter.HumF, "mains hum frequency notched out of the input in Hz, 0 disables it")
+	flag.Float64Var(&s.bandLow, "band-low", cfg.Filter.BandLowF, "lower crossover of the band of the input which is analysed in Hz, 0 leaves it open")
+	flag.Float64Var(&s.bandHigh, "band-high", cfg.Filter.BandHighF, "upper crossover of the band of the input which is analysed in Hz, 0 leaves it open")
+	flag.Var(&s.outputs, "output", "udp output of the form [name=]host:port, can be repeated")
+	flag.Float64Var(&s.sampleRate, "samplerate", cfg.Params.SampleRate, "sample rate the audio is analysed at, 0 uses the rate of the device")
+	flag.IntVar(&s.decimation, "decimation", cfg.Params.Decimation, "factor the audio is decimated by before analysis")
+	flag.Float64Var(&s.brightness, "brightness", cfg.Params.Brightness, "most brightness the colours are sent with, in the range (0, 1]")
+	flag.BoolVar(&s.graph, "graph", cfg.Params.Graph, "render a graph of the frequencies to output.png on exit")
+	flag.BoolVar(&s.spectrogram, "spectrogram", cfg.Spectrogram, "render a spectrogram to spectrogram.png on exit")
+}
+
+// Records which flags were given, it must be called after the flags are
+// parsed and before apply
+func (s *settingFlags) parsed() {
+	s.given = make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		s.given[f.Name] = true
+	})
+}
+
+// Returns a copy of cfg with the settings of the flags which were given
+func (s *settingFlags) apply(cfg lcv.Config) lcv.Config {
+	if s.given["device"] {
+		cfg.InputDevice = s.device
+	}
+	if s.given["gradient"] {
+		cfg.Gradient = s.gradient
+	}
+	if s.given["smooth"] {
+		cfg.Filter.Smooth = s.smooth
+	}
+	if s.given["smooth-alpha"] {
+		cfg.Filter.SmoothAlpha = s.smoothAlpha
+	}
+	if s.given["damp"] {
+		cfg.Filter.Damp = s.damp
+	}
+	if s.given["damp-length"] {
+		cfg.Filter.DampLength = s.dampLength
+	}
+	if s.given["highpass"] {
+		cfg.Filter.HighPassF = s.highPass
+	}
+	if s.given["hum"] {
+		cfg.Filter.HumF = s.hum
+	}
+	if s.given["band-low"] {
+		cfg.Filter.BandLowF = s.bandLow
+	}
+	if s.given["band-high"] {
+		cfg.Filter.BandHighF = s.bandHigh
+	}
+	if len(s.outputs) > 0 {
+		cfg.Outputs = append([]lcv.OutputTarget(nil), s.outputs...)
+	}
+	if s.given["samplerate"] {
+		cfg.Params.SampleRate = s.sampleRate
+	}
+	if s.given["decimation"] {
+		cfg.Params.Decimation = s.decimation
+	}
+	if s.given["brightness"] {
+		cfg.Params.Brightness = s.brightness
+	}
+	if s.given["graph"] {
+		cfg.Params.Graph = s.graph
+	}
+	if s.given["spectrogram"] {
+		cfg.Spectrogram = s.spectrogram
+	}
+	return cfg
+}
+
+// Main
+func main() {
+	// Without a config file the default input device is used and colours
+	// are only sent to the outputs given on the command line
+	cfg := lcv.DefaultConfig()
+	cfg.InputDevice = ""
+	cfg.Outputs = nil
+	var settings settingFlags
+	settings.define(cfg)
+
+	configFile := flag.String("config", "", "json config file, flags which are given override its settings")
+	saveConfig := flag.Bool("save-config", false, "write the settings to the config file and exit")
+	preset := flag.String("preset", "", "name of the preset to start with, it replaces the config file and flags which are given override it")
+	presetDir := flag.String("presets", "", "directory the presets are stored in, the user's config directory is used if empty")
+	gradientDir := flag.String("gradients", "", "directory of the user gradients, the user's config directory is used if empty")
+	watch := flag.Bool("watch", true, "reload the config file and the user gradients when they change")
+	listPresets := flag.Bool("list-presets", false, "list the presets and exit")
+	savePreset := flag.String("save-preset", "", "save the settings as a preset with this name and exit")
+	listDevices := flag.Bool("list-devices", false, "list the input devices and exit")
+	listGradients := flag.Bool("list-gradients", false, "list the gradients and exit")
+	importGradient := flag.String("import-gradient", "", "import a gradient into the gradient directory and exit, from a .json, .css, .ggr or .cpt file or a CSS linear-gradient() string")
+	importName := flag.String("import-name", "", "name of the imported gradient, the name of its file if empty")
+	logFile := flag.String("log", "", "file the log is written to instead of stderr")
+	logLevel := lcv.LevelInfo
+	flag.Var(&logLevel, "log-level", "lowest level logged: debug, info, warn, error or off")
+	logFrames := flag.Int("log-frames", 0, "log every nth analysed frame at the debug level, 0 disables the frame logs")
+	quiet := flag.Bool("quiet", false, "discard the log")
+	metricsAddr := flag.String("metrics", "", "address such as localhost:9100 to serve the analyser's metrics on at /debug/vars, disabled if empty")
+	printFrames := flag.Bool("frames", false, "print the frequency, loudness and colour of every frame to stdout")
+	flag.Parse()
+	settings.parsed()
+
+	if *presetDir == "" {
+		dir, err := lcv.DefaultPresetDir()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Finding the preset directory:", err)
+			os.Exit(1)
+		}
+		*presetDir = dir
+	}
+	presets := lcv.NewPresetStore(*presetDir)
+
+	// The user gradients are loaded first so the config can name one, an
+	// invalid gradient is reported and left out
+	if *gradientDir == "" {
+		dir, err := lcv.DefaultGradientDir()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Finding the gradient directory:", err)
+			os.Exit(1)
+		}
+		*gradientDir = dir
+	}
+	if err := lcv.LoadGradientDir(*gradientDir); err != nil {
+		fmt.Fprintln(os.Stderr, "Loading the gradients:", err)
+	}
+
+	if *importGradient != "" {
+		var gt *lcv.GradientTable
+		var err error
+		name := *importName
+		if strings.Contains(*importGradient, "linear-gradient(") {
+			if name == "" {
+				fmt.Fprintln(os.Stderr, "Importing a CSS gradient string needs -import-name")
+				os.Exit(2)
+			}
+			gt, err = lcv.ParseCSSGradient(*importGradient)
+		} else {
+			if name == "" {
+				name = lcv.ImportedGradientName(*importGradient)
+			}
+			gt, err = lcv.ImportGradient(*importGradient)
+		}
+		if err == nil {
+			err = lcv.AddGradient(*gradientDir, name, gt)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Importing the gradient:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Imported %q with %d stops\n", name, len(gt.Stops))
+		return
+	}
+
+	// The flags which were given override the config file and preset
+	if *configFile != "" || *preset != "" {
+		if *configFile != "" {
+			loaded, err := lcv.LoadConfig(*configFile)
+			switch {
+			case err == nil:
+				cfg = loaded
+			case os.IsNotExist(err) && *saveConfig:
+				// The file is created from the defaults and the flags
+			default:
+				fmt.Fprintln(os.Stderr, "Loading the config:", err)
+				os.Exit(2)
+			}
+		}
+		if *preset != "" {
+			loaded, err := presets.Load(*preset)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Loading the preset:", err)
+				os.Exit(2)
+			}
+			cfg = loaded
+		}
+	}
+	cfg = settings.apply(cfg)
+
+	if *saveConfig {
+		if *configFile == "" {
+			fmt.Fprintln(os.Stderr, "-save-config needs -config")
+			os.Exit(2)
+		}
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if err := cfg.Save(*configFile); err != nil {
+			fmt.Fprintln(os.Stderr, "Saving the config:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *savePreset != "" {
+		if err := presets.Save(*savePreset, cfg); err != nil {
+			fmt.Fprintln(os.Stderr, "Saving the preset:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Logging
+	logger := lcv.DefaultLogger()
+	logger.SetLevel(logLevel)
+	logger.SetFrameSampling(*logFrames)
+	switch {
+	case *quiet:
+		logger.SetLevel(lcv.LevelOff)
+	case *logFile != "":
+		f, err := os.OpenFile(*logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Opening the log:", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		logger.SetOutput(f)
+	}
+
+	if *listDevices {
+		names, err := lcv.InputDevices()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Listing the input devices:", err)
+			os.Exit(1)
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return
+	}
+	if *listPresets {
+		names, err := presets.Names()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Listing the presets:", err)
+			os.Exit(1)
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return
+	}
+	if *listGradients {
+		for _, name := range lcv.GradientNames() {
+			fmt.Println(name)
+		}
+		return
+	}
+
+	opts := []lcv.Option{lcv.WithConfig(cfg)}
+	if *printFrames {
+		opts = append(opts, lcv.WithFrameCallback(func(f lcv.Frame) {
+			fmt.Printf("%5d Hz %6.1f dB #%06x\n", f.Frequency, f.Loudness, f.Colour)
+		}))
+	}
+
+	aa, err := lcv.New(opts...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Creating the analyser:", err)
+		os.Exit(2)
+	}
+
+	// The metrics are served as json by expvar
+	if *metricsAddr != "" {
+		if err := aa.PublishMetrics("analyser"); err != nil {
+			fmt.Fprintln(os.Stderr, "Publishing the metrics:", err)
+			os.Exit(2)
+		}
+		go func() {
+			logger.Info("serving the metrics", "address", *metricsAddr)
+			if err := http.ListenAndServe(*metricsAddr, nil); err != nil {
+				logger.Error("serving the metrics", "err", err)
+			}
+		}()
+	}
+
+	// The analysis is cancelled on the first signal, the outputs are blacked
+	// out by the analyser as it stops
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-sig
+		logger.Info("stopping", "signal", s)
+		cancel()
+	}()
+
+	if err := aa.Start(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "Starting the analyser:", err)
+		os.Exit(1)
+	}
+	// A preset name written to stdin switches the running analyser to it,
+	// keeping the flags overriding it
+	go switchPresets(os.Stdin, presets, &settings, aa)
+
+	// Changes to the config file keep the flags overriding it, a preset
+	// given with -preset replaces the config file so it is not watched
+	if *watch {
+		watchPath := *configFile
+		if *preset != "" {
+			watchPath = ""
+		}
+		r := lcv.NewReloader(aa, watchPath, *gradientDir)
+		r.Adjust = func(c *lcv.Config) {
+			*c = settings.apply(*c)
+		}
+		r.OnConfig = func(err error) {
+			if err != nil {
+				logger.Warn("reloading the config, keeping the previous settings", "file", watchPath, "err", err)
+				return
+			}
+			logger.Info("reloaded the config", "file", watchPath)
+		}
+		r.OnGradients = func(err error) {
+			if err != nil {
+				logger.Warn("reloading the gradients", "dir", *gradientDir, "err", err)
+				return
+			}
+			logger.Info("reloaded the gradients", "dir", *gradientDir)
+		}
+		go r.Run(ctx)
+	}
+
+	if err := aa.Wait(); err != nil {
+		fmt.Fprintln(os.Stderr, "Analysis stopped:", err)
+		os.Exit(1)
+	}
+}
+
+// Applies the preset named on each line read from r to the analyser with the
+// settings given as flags merged in, until r is closed
+func switchPresets(r io.Reader, presets *lcv.PresetStore, settings *settingFlags, aa *lcv.AudioAnalyser) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name == "" {
+			continue
+		}
+
+		cfg, err := presets.Load(name)
+		if err == nil {
+			err = aa.ApplyConfig(settings.apply(cfg))
+		}
+		if err != nil {
+			lcv.DefaultLogger().Warn("switching preset", "preset", name, "err", err)
+			continue
+		}
+		lcv.DefaultLogger().Info("switched preset", "preset", name)
+	}
+}
@@ -0,0 +1,368 @@
+package dspsingle
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// Filter is a stateful filter of real-valued samples.
+// The state carries over between calls, so a stream can be filtered block by block.
+type Filter interface {
+	// ProcessSample filters a single sample.
+	ProcessSample(x float32) float32
+	// Process filters the samples of x in place.
+	Process(x []float32)
+	// Reset clears the state of the filter.
+	Reset()
+}
+
+// Biquad is a second-order IIR filter section, implemented in transposed direct form II.
+// The coefficients are normalised so a0 is 1.
+type Biquad struct {
+	B0, B1, B2 float64
+	A1, A2     float64
+
+	z1, z2 float64
+}
+
+// newBiquad returns a Biquad with the coefficients divided by a0.
+func newBiquad(b0, b1, b2, a0, a1, a2 float64) *Biquad {
+	return &Biquad{
+		B0: b0 / a0,
+		B1: b1 / a0,
+		B2: b2 / a0,
+		A1: a1 / a0,
+		A2: a2 / a0,
+	}
+}
+
+// rbjParams returns the intermediate values of the RBJ cookbook for a section
+// at frequency f with quality q, sampled at fs.
+func rbjParams(f, q, fs float64) (cosw, alpha float64) {
+	if f <= 0 || f >= fs/2 {
+		panic("filter frequency must be between 0 and the Nyquist frequency")
+	}
+	if q <= 0 {
+		panic("filter Q must be positive")
+	}
+
+	w := 2 * math.Pi * f / fs
+	return math.Cos(w), math.Sin(w) / (2 * q)
+}
+
+// NewLowPass returns a second-order low-pass section with cutoff f and quality q.
+func NewLowPass(f, q, fs float64) *Biquad {
+	cosw, alpha := rbjParams(f, q, fs)
+	return newBiquad((1-cosw)/2, 1-cosw, (1-cosw)/2, 1+alpha, -2*cosw, 1-alpha)
+}
+
+// NewHighPass returns a second-order high-pass section with cutoff f and quality q.
+func NewHighPass(f, q, fs float64) *Biquad {
+	cosw, alpha := rbjParams(f, q, fs)
+	return newBiquad((1+cosw)/2, -(1 + cosw), (1+cosw)/2, 1+alpha, -2*cosw, 1-alpha)
+}
+
+// NewBandPass returns a band-pass section centred on f with quality q and a peak gain of 0 dB.
+func NewBandPass(f, q, fs float64) *Biquad {
+	cosw, alpha := rbjParams(f, q, fs)
+	return newBiquad(alpha, 0, -alpha, 1+alpha, -2*cosw, 1-alpha)
+}
+
+// NewNotch returns a notch section removing f, with quality q setting the width of the notch.
+func NewNotch(f, q, fs float64) *Biquad {
+	cosw, alpha := rbjParams(f, q, fs)
+	return newBiquad(1, -2*cosw, 1, 1+alpha, -2*cosw, 1-alpha)
+}
+
+// NewPeaking returns a peaking section boosting or cutting gain dB around f, with quality q.
+func NewPeaking(f, q, gain, fs float64) *Biquad {
+	cosw, alpha := rbjParams(f, q, fs)
+	A := math.Pow(10, gain/40)
+	return newBiquad(1+alpha*A, -2*cosw, 1-alpha*A, 1+alpha/A, -2*cosw, 1-alpha/A)
+}
+
+// NewLowShelf returns a shelving section boosting or cutting gain dB below f.
+// q controls the slope of the shelf, 1/√2 gives the steepest slope without overshoot.
+func NewLowShelf(f, q, gain, fs float64) *Biquad {
+	cosw, alpha := rbjParams(f, q, fs)
+	A := math.Pow(10, gain/40)
+	sa := 2 * math.Sqrt(A) * alpha
+	return newBiquad(
+		A*((A+1)-(A-1)*cosw+sa),
+		2*A*((A-1)-(A+1)*cosw),
+		A*((A+1)-(A-1)*cosw-sa),
+		(A+1)+(A-1)*cosw+sa,
+		-2*((A-1)+(A+1)*cosw),
+		(A+1)+(A-1)*cosw-sa,
+	)
+}
+
+// NewHighShelf returns a shelving section boosting or cutting gain dB above f.
+// q controls the slope of the shelf, 1/√2 gives the steepest slope without overshoot.
+func NewHighShelf(f, q, gain, fs float64) *Biquad {
+	cosw, alpha := rbjParams(f, q, fs)
+	A := math.Pow(10, gain/40)
+	sa := 2 * math.Sqrt(A) * alpha
+	return newBiquad(
+		A*((A+1)+(A-1)*cosw+sa),
+		-2*A*((A-1)+(A+1)*cosw),
+		A*((A+1)+(A-1)*cosw-sa),
+		(A+1)-(A-1)*cosw+sa,
+		2*((A-1)-(A+1)*cosw),
+		(A+1)-(A-1)*cosw-sa,
+	)
+}
+
+// newFirstOrder returns a first-order low-pass or high-pass section, stored as
+// a Biquad with its second-order coefficients set to zero.
+func newFirstOrder(f, fs float64, highpass bool) *Biquad {
+	if f <= 0 || f >= fs/2 {
+		panic("filter frequency must be between 0 and the Nyquist frequency")
+	}
+
+	// Bilinear transform of 1/(s+1) and s/(s+1) with frequency prewarping
+	k := math.Tan(math.Pi * f / fs)
+	if highpass {
+		return newBiquad(1, -1, 0, 1+k, k-1, 0)
+	}
+	return newBiquad(k, k, 0, 1+k, k-1, 0)
+}
+
+// ProcessSample filters a single sample.
+func (b *Biquad) ProcessSample(x float32) float32 {
+	in := float64(x)
+	out := b.B0*in + b.z1
+	b.z1 = b.B1*in - b.A1*out + b.z2
+	b.z2 = b.B2*in - b.A2*out
+	return float32(out)
+}
+
+// Process filters the samples of x in place.
+func (b *Biquad) Process(x []float32) {
+	for i, v := range x {
+		x[i] = b.ProcessSample(v)
+	}
+}
+
+// Reset clears the state of the filter.
+func (b *Biquad) Reset() {
+	b.z1, b.z2 = 0, 0
+}
+
+// Response returns the complex frequency response of the section at f, sampled at fs.
+func (b *Biquad) Response(f, fs float64) complex128 {
+	z := cmplx.Exp(complex(0, -2*math.Pi*f/fs))
+	num := complex(b.B0, 0) + complex(b.B1, 0)*z + complex(b.B2, 0)*z*z
+	den := 1 + complex(b.A1, 0)*z + complex(b.A2, 0)*z*z
+	return num / den
+}
+
+// Copy returns a new Biquad with the same coefficients and cleared state.
+func (b *Biquad) Copy() *Biquad {
+	return &Biquad{B0: b.B0, B1: b.B1, B2: b.B2, A1: b.A1, A2: b.A2}
+}
+
+// Cascade is a series of biquad sections, each filtering the output of the previous one.
+type Cascade []*Biquad
+
+// ProcessSample filters a single sample.
+func (c Cascade) ProcessSample(x float32) float32 {
+	for _, b := range c {
+		x = b.ProcessSample(x)
+	}
+	return x
+}
+
+// Process filters the samples of x in place.
+func (c Cascade) Process(x []float32) {
+	for _, b := range c {
+		b.Process(x)
+	}
+}
+
+// Reset clears the state of every section.
+func (c Cascade) Reset() {
+	for _, b := range c {
+		b.Reset()
+	}
+}
+
+// Response returns the complex frequency response of the cascade at f, sampled at fs.
+func (c Cascade) Response(f, fs float64) complex128 {
+	r := complex(1, 0)
+	for _, b := range c {
+		r *= b.Response(f, fs)
+	}
+	return r
+}
+
+// Copy returns a new Cascade with the same coefficients and cleared state.
+func (c Cascade) Copy() Cascade {
+	r := make(Cascade, len(c))
+	for i, b := range c {
+		r[i] = b.Copy()
+	}
+	return r
+}
+
+// butterworth returns the sections of an order-n Butterworth filter with cutoff f.
+func butterworth(n int, f, fs float64, highpass bool) Cascade {
+	if n < 1 {
+		panic("filter order must be at least 1")
+	}
+
+	r := make(Cascade, 0, (n+1)/2)
+	// Each pair of conjugate poles becomes one section, their Q is set by the pole angle
+	for k := 0; k < n/2; k++ {
+		q := 1 / (2 * math.Sin(math.Pi*float64(2*k+1)/float64(2*n)))
+		if highpass {
+			r = append(r, NewHighPass(f, q, fs))
+		} else {
+			r = append(r, NewLowPass(f, q, fs))
+		}
+	}
+	// An odd order leaves a single real pole
+	if n%2 == 1 {
+		r = append(r, newFirstOrder(f, fs, highpass))
+	}
+
+	return r
+}
+
+// ButterworthLowPass returns an order-n Butterworth low-pass filter with cutoff f.
+func ButterworthLowPass(n int, f, fs float64) Cascade {
+	return butterworth(n, f, fs, false)
+}
+
+// ButterworthHighPass returns an order-n Butterworth high-pass filter with cutoff f.
+func ButterworthHighPass(n int, f, fs float64) Cascade {
+	return butterworth(n, f, fs, true)
+}
+
+// linkwitzRiley returns an order-n Linkwitz-Riley filter, which is two
+// cascaded Butterworth filters of order n/2.
+func linkwitzRiley(n int, f, fs float64, highpass bool) Cascade {
+	if n < 2 || n%2 != 0 {
+		panic("Linkwitz-Riley order must be even")
+	}
+
+	bw := butterworth(n/2, f, fs, highpass)
+	return append(bw, bw.Copy()...)
+}
+
+// LinkwitzRileyLowPass returns an order-n Linkwitz-Riley low-pass filter with cutoff f.
+// n must be even. The low-pass and high-pass outputs of the same order sum to an all-pass
+// response, when n is not a multiple of 4 one of the outputs must be inverted first.
+func LinkwitzRileyLowPass(n int, f, fs float64) Cascade {
+	return linkwitzRiley(n, f, fs, false)
+}
+
+// LinkwitzRileyHighPass returns an order-n Linkwitz-Riley high-pass filter with cutoff f.
+// n must be even. The low-pass and high-pass outputs of the same order sum to an all-pass
+// response, when n is not a multiple of 4 one of the outputs must be inverted first.
+func LinkwitzRileyHighPass(n int, f, fs float64) Cascade {
+	return linkwitzRiley(n, f, fs, true)
+}
+
+// allPass is the sum of the low-pass and high-pass outputs of a Linkwitz-Riley
+// crossover, which has a flat magnitude response and the phase of the crossover.
+type allPass struct {
+	low, high Cascade
+	// invert subtracts the high-pass output, which orders that are not a
+	// multiple of 4 need to sum to an all-pass response.
+	invert bool
+}
+
+// newAllPass returns the all-pass response of an order-n crossover at f.
+func newAllPass(n int, f, fs float64) *allPass {
+	return &allPass{
+		low:    LinkwitzRileyLowPass(n, f, fs),
+		high:   LinkwitzRileyHighPass(n, f, fs),
+		invert: n%4 != 0,
+	}
+}
+
+// ProcessSample filters a single sample.
+func (a *allPass) ProcessSample(x float32) float32 {
+	if a.invert {
+		return a.low.ProcessSample(x) - a.high.ProcessSample(x)
+	}
+	return a.low.ProcessSample(x) + a.high.ProcessSample(x)
+}
+
+// Process filters the samples of x in place.
+func (a *allPass) Process(x []float32) {
+	for i, v := range x {
+		x[i] = a.ProcessSample(v)
+	}
+}
+
+// Reset clears the state of the filter.
+func (a *allPass) Reset() {
+	a.low.Reset()
+	a.high.Reset()
+}
+
+// BandSplitter splits a signal into frequency bands with Linkwitz-Riley crossovers.
+// Each band below the top crossover is passed through the all-pass response of
+// every crossover above it, so all bands have the same phase and sum back to an
+// all-pass copy of the signal. When n is not a multiple of 4 the bands must be
+// summed with alternating signs, as the outputs of a single crossover must.
+type BandSplitter struct {
+	lows, highs []Cascade
+	// comps[i] holds the all-pass sections of the crossovers above band i.
+	comps [][]*allPass
+}
+
+// NewBandSplitter returns a BandSplitter with crossovers of order n at each of the
+// ascending frequencies in crossovers, giving len(crossovers)+1 bands.
+func NewBandSplitter(n int, crossovers []float64, fs float64) *BandSplitter {
+	s := &BandSplitter{}
+	for i, f := range crossovers {
+		if i > 0 && f <= crossovers[i-1] {
+			panic("crossover frequencies must be ascending")
+		}
+		s.lows = append(s.lows, LinkwitzRileyLowPass(n, f, fs))
+		s.highs = append(s.highs, LinkwitzRileyHighPass(n, f, fs))
+
+		var comp []*allPass
+		for _, above := range crossovers[i+1:] {
+			comp = append(comp, newAllPass(n, above, fs))
+		}
+		s.comps = append(s.comps, comp)
+	}
+	return s
+}
+
+// Split returns the bands of x from lowest to highest. x is not modified.
+// Each crossover splits the remaining upper part of the signal, so the state of
+// every filter carries over between calls.
+func (s *BandSplitter) Split(x []float32) [][]float32 {
+	bands := make([][]float32, 0, len(s.lows)+1)
+
+	rest := make([]float32, len(x))
+	copy(rest, x)
+	for i := range s.lows {
+		low := make([]float32, len(rest))
+		copy(low, rest)
+		s.lows[i].Process(low)
+		s.highs[i].Process(rest)
+		for _, a := range s.comps[i] {
+			a.Process(low)
+		}
+		bands = append(bands, low)
+	}
+
+	return append(bands, rest)
+}
+
+// Reset clears the state of every crossover.
+func (s *BandSplitter) Reset() {
+	for i := range s.lows {
+		s.lows[i].Reset()
+		s.highs[i].Reset()
+		for _, a := range s.comps[i] {
+			a.Reset()
+		}
+	}
+}
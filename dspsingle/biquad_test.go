@@ -0,0 +1,175 @@
+package dspsingle
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"testing"
+)
+
+const testRate = 48000.0
+
+func db(g float64) float64 {
+	return 20 * math.Log10(g)
+}
+
+func noise(n int, seed int64) []float32 {
+	r := rand.New(rand.NewSource(seed))
+	x := make([]float32, n)
+	for i := range x {
+		x[i] = float32(r.Float64()*2 - 1)
+	}
+	return x
+}
+
+// Returns the magnitude of the DFT of x at f, sampled at fs
+func dftMagnitude(x []float32, f, fs float64) float64 {
+	var sum complex128
+	for i, v := range x {
+		sum += complex(float64(v), 0) * cmplx.Exp(complex(0, -2*math.Pi*f*float64(i)/fs))
+	}
+	return cmplx.Abs(sum)
+}
+
+func TestButterworthCutoff(t *testing.T) {
+	for n := 1; n <= 8; n++ {
+		for _, f := range []float64{50, 1000, 10000} {
+			lp := db(cmplx.Abs(ButterworthLowPass(n, f, testRate).Response(f, testRate)))
+			hp := db(cmplx.Abs(ButterworthHighPass(n, f, testRate).Response(f, testRate)))
+			want := db(math.Sqrt(0.5))
+			if math.Abs(lp-want) > 0.01 {
+				t.Errorf("order %d low-pass at %g Hz: gain %.3f dB at the cutoff, want %.3f dB", n, f, lp, want)
+			}
+			if math.Abs(hp-want) > 0.01 {
+				t.Errorf("order %d high-pass at %g Hz: gain %.3f dB at the cutoff, want %.3f dB", n, f, hp, want)
+			}
+
+			// The passband is flat a decade away from the cutoff
+			if f*10 < testRate/2 {
+				if g := db(cmplx.Abs(ButterworthHighPass(n, f, testRate).Response(f*10, testRate))); math.Abs(g) > 0.1 {
+					t.Errorf("order %d high-pass at %g Hz: gain %.3f dB in the passband", n, f, g)
+				}
+			}
+			if g := db(cmplx.Abs(ButterworthLowPass(n, f, testRate).Response(f/10, testRate))); math.Abs(g) > 0.1 {
+				t.Errorf("order %d low-pass at %g Hz: gain %.3f dB in the passband", n, f, g)
+			}
+		}
+	}
+}
+
+func TestNotchDepth(t *testing.T) {
+	for _, f := range []float64{50, 60, 1000} {
+		n := NewNotch(f, 10, testRate)
+		if g := db(cmplx.Abs(n.Response(f, testRate))); g > -100 {
+			t.Errorf("notch at %g Hz: gain %.1f dB at the notch, want below -100 dB", f, g)
+		}
+		// An octave away the notch has no effect
+		for _, away := range []float64{f / 2, f * 2} {
+			if g := db(cmplx.Abs(n.Response(away, testRate))); math.Abs(g) > 0.1 {
+				t.Errorf("notch at %g Hz: gain %.3f dB at %g Hz", f, g, away)
+			}
+		}
+
+		// A tone at the notch dies away once the filter settles
+		x := make([]float32, int(testRate))
+		for i := range x {
+			x[i] = float32(math.Sin(2 * math.Pi * f * float64(i) / testRate))
+		}
+		n.Process(x)
+		var peak float64
+		for _, v := range x[len(x)/2:] {
+			peak = math.Max(peak, math.Abs(float64(v)))
+		}
+		if g := db(peak); g > -60 {
+			t.Errorf("notch at %g Hz: settled tone at %.1f dB, want below -60 dB", f, g)
+		}
+	}
+}
+
+func TestLinkwitzRileySum(t *testing.T) {
+	const fc = 1000
+	for f := 20.0; f < testRate/2; f *= 1.5 {
+		lp := LinkwitzRileyLowPass(4, fc, testRate).Response(f, testRate)
+		hp := LinkwitzRileyHighPass(4, fc, testRate).Response(f, testRate)
+		if g := cmplx.Abs(lp + hp); math.Abs(g-1) > 1e-6 {
+			t.Errorf("LR4 at %g Hz: low and high sum to a gain of %g, want 1", f, g)
+		}
+	}
+
+	// The bands at the crossover are each -6 dB
+	if g := db(cmplx.Abs(LinkwitzRileyLowPass(4, fc, testRate).Response(fc, testRate))); math.Abs(g-db(0.5)) > 0.01 {
+		t.Errorf("LR4 low-pass: gain %.3f dB at the crossover, want %.3f dB", g, db(0.5))
+	}
+}
+
+func TestBandSplitterSum(t *testing.T) {
+	for _, n := range []int{2, 4, 8} {
+		s := NewBandSplitter(n, []float64{200, 2000, 8000}, testRate)
+
+		impulse := make([]float32, 1<<13)
+		impulse[0] = 1
+		bands := s.Split(impulse)
+		if len(bands) != 4 {
+			t.Fatalf("order %d: got %d bands, want 4", n, len(bands))
+		}
+
+		sum := make([]float32, len(impulse))
+		for i, b := range bands {
+			sign := float32(1)
+			if n%4 != 0 && i%2 == 1 {
+				sign = -1
+			}
+			for j, v := range b {
+				sum[j] += sign * v
+			}
+		}
+
+		for _, f := range []float64{50, 200, 700, 2000, 5000, 8000, 15000} {
+			if g := db(dftMagnitude(sum, f, testRate)); math.Abs(g) > 0.05 {
+				t.Errorf("order %d: bands sum to %.3f dB at %g Hz, want 0 dB", n, g, f)
+			}
+		}
+	}
+}
+
+func TestProcessMatchesProcessSample(t *testing.T) {
+	filters := map[string]func() Filter{
+		"biquad":      func() Filter { return NewPeaking(1000, 2, 6, testRate) },
+		"butterworth": func() Filter { return ButterworthLowPass(5, 3000, testRate) },
+		"lr4":         func() Filter { return LinkwitzRileyHighPass(4, 500, testRate) },
+		"all-pass":    func() Filter { return newAllPass(4, 500, testRate) },
+	}
+
+	x := noise(4096, 1)
+	for name, newFilter := range filters {
+		bySample := newFilter()
+		want := make([]float32, len(x))
+		for i, v := range x {
+			want[i] = bySample.ProcessSample(v)
+		}
+
+		// Uneven blocks check the state carries over between calls
+		byBlock := newFilter()
+		got := append([]float32(nil), x...)
+		for start, size := 0, 1; start < len(got); start, size = start+size, size*3%509+1 {
+			end := start + size
+			if end > len(got) {
+				end = len(got)
+			}
+			byBlock.Process(got[start:end])
+		}
+
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: sample %d is %g in blocks, want %g", name, i, got[i], want[i])
+				break
+			}
+		}
+
+		// Reset returns the filter to its initial state
+		byBlock.Reset()
+		if v := byBlock.ProcessSample(x[0]); v != want[0] {
+			t.Errorf("%s: first sample after reset is %g, want %g", name, v, want[0])
+		}
+	}
+}
@@ -86,10 +86,38 @@ func ToComplex2(x [][]float32) [][]complex64 {
 // The returned slices are not copies of x, but slices into it.
 // Trailing entries in x that connot be included in the equal-length segments are discarded.
 // noverlap is a percentage, thus 0 <= noverlap <= 1, and noverlap = 0.5 is 50% overlap.
-func Segment(x []complex128, segs int, noverlap float64) [][]complex128 {
-	lx := len(x)
+// Unlike the go-dsp original, which takes complex128, x is complex64 to match
+// the rest of this single precision package.
+func Segment(x []complex64, segs int, noverlap float64) [][]complex64 {
+	length, step := segmentLength(len(x), segs, noverlap)
 
-	// determine step, length, and overlap
+	r := make([][]complex64, segs)
+	s := 0
+	for n := range r {
+		r[n] = x[s : s+length]
+		s += step
+	}
+
+	return r
+}
+
+// SegmentF is Segment for real-valued slices.
+func SegmentF(x []float32, segs int, noverlap float64) [][]float32 {
+	length, step := segmentLength(len(x), segs, noverlap)
+
+	r := make([][]float32, segs)
+	s := 0
+	for n := range r {
+		r[n] = x[s : s+length]
+		s += step
+	}
+
+	return r
+}
+
+// segmentLength returns the longest segment length, and the step between segments,
+// which fits segs segments with noverlap% of overlap into lx entries.
+func segmentLength(lx, segs int, noverlap float64) (int, int) {
 	var overlap, length, step, tot int
 	for length = lx; length > 0; length-- {
 		overlap = int(float64(length) * noverlap)
@@ -104,11 +132,23 @@ func Segment(x []complex128, segs int, noverlap float64) [][]complex128 {
 		panic("too many segments")
 	}
 
-	r := make([][]complex128, segs)
-	s := 0
+	return length, step
+}
+
+// FrameF returns the length-long segments of x which start every hop entries.
+// The returned slices are not copies of x, but slices into it.
+// Trailing entries in x that cannot fill a whole segment are discarded.
+func FrameF(x []float32, length, hop int) [][]float32 {
+	if length < 1 || hop < 1 {
+		panic("invalid segment length or hop")
+	}
+	if len(x) < length {
+		return [][]float32{}
+	}
+
+	r := make([][]float32, (len(x)-length)/hop+1)
 	for n := range r {
-		r[n] = x[s : s+length]
-		s += step
+		r[n] = x[n*hop : n*hop+length]
 	}
 
 	return r
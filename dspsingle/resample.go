@@ -0,0 +1,184 @@
+package dspsingle
+
+import (
+	"math"
+)
+
+const (
+	// resampleTaps is the number of input samples each output sample of a Resampler is calculated from.
+	resampleTaps = 32
+	// resampleRolloff is the fraction of the lower Nyquist frequency the anti-alias filters pass.
+	resampleRolloff = 0.9
+)
+
+// gcd returns the greatest common divisor of a and b.
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// lowPassFIR returns a Blackman windowed-sinc low-pass filter of length n,
+// with cutoff fc as a fraction of the sample rate, scaled to a DC gain of gain.
+func lowPassFIR(n int, fc, gain float64) []float64 {
+	h := make([]float64, n)
+	mid := float64(n-1) / 2
+
+	var sum float64
+	for i := range h {
+		x := float64(i) - mid
+		s := 2 * fc
+		if x != 0 {
+			s = math.Sin(2*math.Pi*fc*x) / (math.Pi * x)
+		}
+		w := 0.42 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1)) + 0.08*math.Cos(4*math.Pi*float64(i)/float64(n-1))
+		h[i] = s * w
+		sum += h[i]
+	}
+
+	for i := range h {
+		h[i] *= gain / sum
+	}
+	return h
+}
+
+// Resampler converts a stream between two sample rates with a polyphase FIR filter.
+// The rates are reduced to the ratio up/down, the stream is conceptually upsampled by up,
+// low-pass filtered and downsampled by down, but only the needed outputs are computed.
+// The state carries over between calls, so a stream can be resampled block by block.
+type Resampler struct {
+	up, down int
+	// phases[p] holds the filter taps used for outputs at phase p of the upsampled stream,
+	// in the order they are applied to the newest input sample first.
+	phases [][]float64
+	// hist holds the last resampleTaps-1 input samples of the previous block.
+	hist []float32
+	// pos is the position of the next output in the upsampled stream, relative
+	// to the start of hist.
+	pos int
+}
+
+// NewResampler returns a Resampler converting from inRate to outRate.
+func NewResampler(inRate, outRate int) *Resampler {
+	if inRate < 1 || outRate < 1 {
+		panic("sample rates must be positive")
+	}
+
+	g := gcd(inRate, outRate)
+	up, down := outRate/g, inRate/g
+
+	// The filter runs at the upsampled rate and must remove the images of
+	// the upsampling and anything above the output Nyquist frequency
+	m := up
+	if down > m {
+		m = down
+	}
+	h := lowPassFIR(up*resampleTaps, resampleRolloff*0.5/float64(m), float64(up))
+
+	phases := make([][]float64, up)
+	for p := range phases {
+		phases[p] = make([]float64, resampleTaps)
+		for k := range phases[p] {
+			phases[p][k] = h[p+k*up]
+		}
+	}
+
+	r := &Resampler{up: up, down: down, phases: phases}
+	r.Reset()
+	return r
+}
+
+// Ratio returns the number of output samples produced per input sample.
+func (r *Resampler) Ratio() float64 {
+	return float64(r.up) / float64(r.down)
+}
+
+// Process returns the resampled samples of the block x.
+// The number of samples returned varies between blocks so the total follows the ratio exactly.
+func (r *Resampler) Process(x []float32) []float32 {
+	buf := append(r.hist, x...)
+
+	out := make([]float32, 0, int(float64(len(x))*r.Ratio())+1)
+	for {
+		i := r.pos / r.up
+		if i >= len(buf) {
+			break
+		}
+
+		taps := r.phases[r.pos%r.up]
+		var sum float64
+		for k, h := range taps {
+			sum += h * float64(buf[i-k])
+		}
+		out = append(out, float32(sum))
+
+		r.pos += r.down
+	}
+
+	// Keep the newest samples for the filter taps of the next block
+	keep := len(buf) - (resampleTaps - 1)
+	r.hist = append(r.hist[:0], buf[keep:]...)
+	r.pos -= keep * r.up
+
+	return out
+}
+
+// Reset clears the state of the resampler.
+func (r *Resampler) Reset() {
+	r.hist = make([]float32, resampleTaps-1)
+	r.pos = (resampleTaps - 1) * r.up
+}
+
+// Decimator reduces the sample rate of a stream by an integer factor.
+// The stream is low-pass filtered before every factor-th sample is kept, so
+// frequencies above the new Nyquist frequency do not alias.
+// The state carries over between calls, so a stream can be decimated block by block.
+type Decimator struct {
+	factor int
+	filter Cascade
+	// phase is the number of samples to skip before the next one is kept.
+	phase int
+}
+
+// NewDecimator returns a Decimator which keeps one in every factor samples.
+// The anti-alias filter is an 8th order Butterworth low-pass.
+func NewDecimator(factor int) *Decimator {
+	if factor < 1 {
+		panic("decimation factor must be at least 1")
+	}
+
+	d := &Decimator{factor: factor}
+	if factor > 1 {
+		// The cutoff is relative to a sample rate of 1
+		d.filter = ButterworthLowPass(8, resampleRolloff*0.5/float64(factor), 1)
+	}
+	return d
+}
+
+// Factor returns the decimation factor.
+func (d *Decimator) Factor() int {
+	return d.factor
+}
+
+// Process returns the decimated samples of the block x. x is not modified.
+func (d *Decimator) Process(x []float32) []float32 {
+	out := make([]float32, 0, len(x)/d.factor+1)
+	for _, v := range x {
+		if d.filter != nil {
+			v = d.filter.ProcessSample(v)
+		}
+		if d.phase == 0 {
+			out = append(out, v)
+			d.phase = d.factor
+		}
+		d.phase--
+	}
+	return out
+}
+
+// Reset clears the state of the decimator.
+func (d *Decimator) Reset() {
+	d.filter.Reset()
+	d.phase = 0
+}
@@ -0,0 +1,123 @@
+package dspsingle
+
+import (
+	"math"
+	"testing"
+)
+
+func sine(n int, f, fs float64) []float32 {
+	x := make([]float32, n)
+	for i := range x {
+		x[i] = float32(math.Sin(2 * math.Pi * f * float64(i) / fs))
+	}
+	return x
+}
+
+// Returns the peak magnitude of x after skipping the first skip samples
+func peak(x []float32, skip int) float64 {
+	var p float64
+	for _, v := range x[skip:] {
+		p = math.Max(p, math.Abs(float64(v)))
+	}
+	return p
+}
+
+func TestResamplerLength(t *testing.T) {
+	tests := []struct{ in, out int }{
+		{44100, 48000},
+		{48000, 44100},
+		{96000, 48000},
+		{22050, 44100},
+	}
+
+	for _, tt := range tests {
+		r := NewResampler(tt.in, tt.out)
+		var total int
+		for i := 0; i < 100; i++ {
+			total += len(r.Process(make([]float32, 441)))
+		}
+		// The first output is at the first input, so a partial output
+		// period at the end still has a sample
+		if want := (441*100*tt.out + tt.in - 1) / tt.in; total != want {
+			t.Errorf("%d to %d Hz: got %d samples, want %d", tt.in, tt.out, total, want)
+		}
+	}
+}
+
+func TestResamplerTone(t *testing.T) {
+	const in, out, f = 44100, 48000, 1000
+	y := NewResampler(in, out).Process(sine(in, f, in))
+
+	// The tone keeps its amplitude and is at the same frequency at the new rate
+	if g := db(peak(y, 1000)); math.Abs(g) > 0.1 {
+		t.Errorf("tone at %.3f dB after resampling, want 0 dB", g)
+	}
+	n := len(y) - 1000
+	if at, off := dftMagnitude(y[1000:], f, out), dftMagnitude(y[1000:], f*1.1, out); at < float64(n)/2*0.99 || off > at/100 {
+		t.Errorf("DFT magnitude %g at %d Hz and %g off it, want the tone at %d Hz", at, f, off, f)
+	}
+}
+
+func TestResamplerBlocks(t *testing.T) {
+	x := noise(10000, 1)
+	want := NewResampler(44100, 48000).Process(x)
+
+	r := NewResampler(44100, 48000)
+	var got []float32
+	for start, size := 0, 1; start < len(x); start, size = start+size, size*7%1031+1 {
+		end := start + size
+		if end > len(x) {
+			end = len(x)
+		}
+		got = append(got, r.Process(x[start:end])...)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d samples in blocks, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sample %d is %g in blocks, want %g", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDecimator(t *testing.T) {
+	const fs, factor = 48000, 4
+
+	// A tone below the new Nyquist frequency passes
+	y := NewDecimator(factor).Process(sine(fs, 1000, fs))
+	if len(y) != fs/factor {
+		t.Fatalf("got %d samples, want %d", len(y), fs/factor)
+	}
+	if g := db(peak(y, 1000)); math.Abs(g) > 0.1 {
+		t.Errorf("1000 Hz tone at %.3f dB after decimation, want 0 dB", g)
+	}
+
+	// A tone above it would alias, so it is removed
+	y = NewDecimator(factor).Process(sine(fs, 9000, fs))
+	if g := db(peak(y, 1000)); g > -40 {
+		t.Errorf("9000 Hz tone at %.1f dB after decimation, want below -40 dB", g)
+	}
+
+	// Decimating in blocks gives the same samples
+	x := noise(10000, 2)
+	want := NewDecimator(factor).Process(x)
+	d := NewDecimator(factor)
+	var got []float32
+	for start, size := 0, 1; start < len(x); start, size = start+size, size*5%97+1 {
+		end := start + size
+		if end > len(x) {
+			end = len(x)
+		}
+		got = append(got, d.Process(x[start:end])...)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d samples in blocks, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sample %d is %g in blocks, want %g", i, got[i], want[i])
+		}
+	}
+}
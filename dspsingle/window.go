@@ -0,0 +1,55 @@
+package dspsingle
+
+import (
+	"math"
+)
+
+// Rectangular returns an L-point rectangular window (all values are 1).
+func Rectangular(L int) []float32 {
+	r := make([]float32, L)
+	for i := range r {
+		r[i] = 1
+	}
+	return r
+}
+
+// Hann returns an L-point periodic Hann window.
+// The periodic form sums to a constant when overlapped by half its length,
+// which is what the STFT and Welch estimators expect.
+func Hann(L int) []float32 {
+	return cosineWindow(L, 0.5, 0.5, 0)
+}
+
+// Hamming returns an L-point periodic Hamming window.
+func Hamming(L int) []float32 {
+	return cosineWindow(L, 0.54, 0.46, 0)
+}
+
+// Blackman returns an L-point periodic Blackman window.
+func Blackman(L int) []float32 {
+	return cosineWindow(L, 0.42, 0.5, 0.08)
+}
+
+// cosineWindow returns the L-point periodic window a0 - a1*cos(2πn/L) + a2*cos(4πn/L).
+func cosineWindow(L int, a0, a1, a2 float64) []float32 {
+	r := make([]float32, L)
+	for n := range r {
+		x := 2 * math.Pi * float64(n) / float64(L)
+		r[n] = float32(a0 - a1*math.Cos(x) + a2*math.Cos(2*x))
+	}
+	return r
+}
+
+// ApplyWindow returns x multiplied element-wise by the window w.
+// If len(w) != len(x), ApplyWindow panics.
+func ApplyWindow(x, w []float32) []float32 {
+	if len(x) != len(w) {
+		panic("window and input not of equal size")
+	}
+
+	r := make([]float32, len(x))
+	for i, v := range x {
+		r[i] = v * w[i]
+	}
+	return r
+}
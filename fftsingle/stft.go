@@ -0,0 +1,166 @@
+package fftsingle
+
+import (
+	"github.com/nadav-rahimi/led-colour-visualiser/dspsingle"
+)
+
+// STFTOptions configures the short-time Fourier transform and its inverse.
+// The STFT and Welch estimators are in fftsingle rather than dspsingle as they
+// need the FFT, and dspsingle cannot import fftsingle without an import cycle.
+type STFTOptions struct {
+	// Window is applied to each segment, its length is the segment length.
+	Window []float32
+	// Hop is the number of samples between the start of consecutive segments.
+	// If Hop is 0, half the window length is used.
+	Hop int
+	// NFFT is the length each segment is zero padded to before the FFT.
+	// If NFFT is 0, the window length is used.
+	NFFT int
+	// Center pads both ends of the signal with half a window of zeros, so the
+	// first and last samples are at the centre of a segment.
+	Center bool
+	// PadEnd zero pads the end of the signal so trailing samples which do not
+	// fill a whole segment are still transformed.
+	PadEnd bool
+}
+
+// hop returns the hop size, applying the default if unset.
+func (o STFTOptions) hop() int {
+	if o.Hop > 0 {
+		return o.Hop
+	}
+	if h := len(o.Window) / 2; h > 0 {
+		return h
+	}
+	return 1
+}
+
+// nfft returns the FFT length, applying the default if unset.
+func (o STFTOptions) nfft() int {
+	if o.NFFT > 0 {
+		return o.NFFT
+	}
+	return len(o.Window)
+}
+
+// RealSpectrum returns the one-sided FFT of the real-valued slice x, which is the
+// first nfft/2+1 bins, as the rest are the complex conjugate of these.
+// If w is not nil, x is multiplied by the window w first. x is zero padded
+// to nfft, if nfft is less than len(x) then len(x) is used.
+func RealSpectrum(x []float32, w []float32, nfft int) []complex64 {
+	if w != nil {
+		x = dspsingle.ApplyWindow(x, w)
+	}
+	if nfft < len(x) {
+		nfft = len(x)
+	}
+
+	c := dspsingle.ZeroPad(dspsingle.ToComplex(x), nfft)
+	return FFT(c)[:nfft/2+1]
+}
+
+// STFT returns the short-time Fourier transform of the real-valued slice x.
+// The returned Matrix has one row per segment and NFFT/2+1 columns holding
+// the one-sided spectrum of the segment.
+func STFT(x []float32, o STFTOptions) *dspsingle.Matrix {
+	wl := len(o.Window)
+	if wl == 0 {
+		panic("empty window")
+	}
+	if o.nfft() < wl {
+		panic("NFFT shorter than window")
+	}
+
+	hop := o.hop()
+	if o.Center {
+		p := make([]float32, len(x)+2*(wl/2))
+		copy(p[wl/2:], x)
+		x = p
+	}
+	if o.PadEnd {
+		n := 1
+		if len(x) > wl {
+			n = (len(x)-wl+hop-1)/hop + 1
+		}
+		if l := (n-1)*hop + wl; l > len(x) {
+			p := make([]float32, l)
+			copy(p, x)
+			x = p
+		}
+	}
+
+	frames := dspsingle.FrameF(x, wl, hop)
+	if len(frames) == 0 {
+		panic("signal shorter than window")
+	}
+
+	bins := o.nfft()/2 + 1
+	r := dspsingle.MakeEmptyMatrix([]int{len(frames), bins})
+	for n, f := range frames {
+		r.SetDim(RealSpectrum(f, o.Window, o.nfft()), []int{n, -1})
+	}
+
+	return r
+}
+
+// ISTFT returns the real-valued signal whose short-time Fourier transform is m,
+// using the same options m was created with. The segments are recombined with
+// a weighted overlap-add, so any window which has no zeros where the segments
+// overlap is reconstructed exactly. If length is greater than 0, the result
+// is truncated or zero padded to length samples.
+func ISTFT(m *dspsingle.Matrix, o STFTOptions, length int) []float32 {
+	wl := len(o.Window)
+	dims := m.Dimensions()
+	if len(dims) != 2 || wl == 0 {
+		panic("incorrect dimensions")
+	}
+
+	nfft := o.nfft()
+	if dims[1] != nfft/2+1 {
+		panic("incorrect dimensions")
+	}
+
+	hop := o.hop()
+	out := make([]float32, (dims[0]-1)*hop+wl)
+	norm := make([]float32, len(out))
+
+	full := make([]complex64, nfft)
+	for n := 0; n < dims[0]; n++ {
+		half := m.Dim([]int{n, -1})
+
+		// Rebuild the mirrored half of the spectrum of the real segment
+		copy(full, half)
+		for k := len(half); k < nfft; k++ {
+			v := half[nfft-k]
+			full[k] = complex(real(v), -imag(v))
+		}
+
+		seg := IFFT(full)
+		s := n * hop
+		for i := 0; i < wl; i++ {
+			out[s+i] += real(seg[i]) * o.Window[i]
+			norm[s+i] += o.Window[i] * o.Window[i]
+		}
+	}
+
+	for i, v := range norm {
+		if v > 1e-8 {
+			out[i] /= v
+		}
+	}
+
+	if o.Center {
+		out = out[wl/2:]
+	}
+	if length > 0 {
+		if length <= len(out) {
+			out = out[:length]
+		} else {
+			p := make([]float32, length)
+			copy(p, out)
+			out = p
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,91 @@
+package fftsingle
+
+import (
+	"github.com/nadav-rahimi/led-colour-visualiser/dspsingle"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func randomSignal(n int, seed int64) []float32 {
+	r := rand.New(rand.NewSource(seed))
+	x := make([]float32, n)
+	for i := range x {
+		x[i] = float32(r.Float64()*2 - 1)
+	}
+	return x
+}
+
+func TestSTFTRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		o    STFTOptions
+	}{
+		{"hann centred", STFTOptions{Window: dspsingle.Hann(64), Hop: 16, Center: true}},
+		{"hann centred padded", STFTOptions{Window: dspsingle.Hann(64), Hop: 16, Center: true, PadEnd: true}},
+		{"hann zero padded fft", STFTOptions{Window: dspsingle.Hann(60), Hop: 15, NFFT: 128, Center: true}},
+		{"rectangular padded end", STFTOptions{Window: dspsingle.Rectangular(64), Hop: 64, PadEnd: true}},
+	}
+
+	x := randomSignal(1000, 1)
+	for _, tt := range tests {
+		m := STFT(x, tt.o)
+		y := ISTFT(m, tt.o, len(x))
+		if len(y) != len(x) {
+			t.Fatalf("%s: got %d samples, want %d", tt.name, len(y), len(x))
+		}
+		for i := range x {
+			if math.Abs(float64(y[i]-x[i])) > 1e-4 {
+				t.Errorf("%s: sample %d is %g, want %g", tt.name, i, y[i], x[i])
+				break
+			}
+		}
+	}
+}
+
+func TestSTFTUncentredEdges(t *testing.T) {
+	const wl, hop = 64, 16
+	o := STFTOptions{Window: dspsingle.Hann(wl), Hop: hop}
+	x := randomSignal(1000, 2)
+
+	m := STFT(x, o)
+	frames := m.Dimensions()[0]
+	if want := (len(x)-wl)/hop + 1; frames != want {
+		t.Fatalf("got %d segments, want %d", frames, want)
+	}
+
+	y := ISTFT(m, o, len(x))
+	end := (frames-1)*hop + wl
+
+	// The periodic Hann window is zero at its first sample, so without
+	// centring the first sample is in no segment with any weight
+	if y[0] != 0 {
+		t.Errorf("sample 0 is %g, want 0", y[0])
+	}
+	for i := 1; i < end; i++ {
+		if math.Abs(float64(y[i]-x[i])) > 1e-4 {
+			t.Fatalf("sample %d is %g, want %g", i, y[i], x[i])
+		}
+	}
+	// Trailing samples which do not fill a segment are dropped
+	for i := end; i < len(x); i++ {
+		if y[i] != 0 {
+			t.Fatalf("sample %d after the last segment is %g, want 0", i, y[i])
+		}
+	}
+}
+
+func TestSTFTShape(t *testing.T) {
+	x := randomSignal(300, 3)
+
+	m := STFT(x, STFTOptions{Window: dspsingle.Hann(64), Hop: 32, NFFT: 256, Center: true})
+	// 300 samples padded by 32 each side gives 364, so (364-64)/32+1 segments
+	if dims := m.Dimensions(); dims[0] != 10 || dims[1] != 129 {
+		t.Errorf("got dimensions %v, want [10 129]", dims)
+	}
+
+	m = STFT(x, STFTOptions{Window: dspsingle.Hann(64), Hop: 32, PadEnd: true})
+	if dims := m.Dimensions(); dims[0] != 9 || dims[1] != 33 {
+		t.Errorf("got dimensions %v, want [9 33]", dims)
+	}
+}
@@ -0,0 +1,68 @@
+package fftsingle
+
+import (
+	"github.com/nadav-rahimi/led-colour-visualiser/dspsingle"
+)
+
+// WelchOptions configures Welch's power spectral density estimate.
+type WelchOptions struct {
+	// Window is applied to each segment, its length is the segment length.
+	// If Window is nil, a Hann window of 256 samples, or the length of the
+	// signal if it is shorter, is used.
+	Window []float32
+	// Hop is the number of samples between the start of consecutive segments.
+	// If Hop is 0, half the window length is used.
+	Hop int
+	// NFFT is the length each segment is zero padded to before the FFT.
+	// If NFFT is 0, the window length is used.
+	NFFT int
+}
+
+// Welch returns the one-sided power spectral density of the real-valued slice x
+// sampled at fs, estimated by averaging the periodograms of its overlapping
+// windowed segments, and the frequency of each bin of the estimate.
+// The density is in units of x squared per Hz.
+func Welch(x []float32, fs float64, o WelchOptions) (psd []float32, freqs []float32) {
+	if o.Window == nil {
+		l := 256
+		if len(x) < l {
+			l = len(x)
+		}
+		o.Window = dspsingle.Hann(l)
+	}
+
+	m := STFT(x, STFTOptions{Window: o.Window, Hop: o.Hop, NFFT: o.NFFT})
+	dims := m.Dimensions()
+	nfft := o.NFFT
+	if nfft == 0 {
+		nfft = len(o.Window)
+	}
+
+	var wpow float64
+	for _, v := range o.Window {
+		wpow += float64(v) * float64(v)
+	}
+	scale := 1 / (fs * wpow * float64(dims[0]))
+
+	acc := make([]float64, dims[1])
+	for n := 0; n < dims[0]; n++ {
+		for k, v := range m.Dim([]int{n, -1}) {
+			acc[k] += float64(real(v)*real(v) + imag(v)*imag(v))
+		}
+	}
+
+	psd = make([]float32, dims[1])
+	freqs = make([]float32, dims[1])
+	for k, v := range acc {
+		p := v * scale
+		// Every bin other than DC and Nyquist also holds the power of its
+		// mirrored negative frequency
+		if k != 0 && !(nfft%2 == 0 && k == dims[1]-1) {
+			p *= 2
+		}
+		psd[k] = float32(p)
+		freqs[k] = float32(float64(k) * fs / float64(nfft))
+	}
+
+	return psd, freqs
+}
@@ -0,0 +1,78 @@
+package fftsingle
+
+import (
+	"github.com/nadav-rahimi/led-colour-visualiser/dspsingle"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestWelchWhiteNoise(t *testing.T) {
+	const fs, n, sigma = 8000.0, 1 << 16, 0.5
+	r := rand.New(rand.NewSource(1))
+	x := make([]float32, n)
+	var power float64
+	for i := range x {
+		x[i] = float32(r.NormFloat64() * sigma)
+		power += float64(x[i]) * float64(x[i])
+	}
+	power /= n
+
+	psd, freqs := Welch(x, fs, WelchOptions{Window: dspsingle.Hann(512)})
+	if len(psd) != 257 || freqs[len(freqs)-1] != fs/2 {
+		t.Fatalf("got %d bins up to %g Hz, want 257 up to %g Hz", len(psd), freqs[len(freqs)-1], fs/2)
+	}
+
+	// Parseval, the density integrates to the power of the signal
+	df := float64(freqs[1] - freqs[0])
+	var total float64
+	for _, p := range psd {
+		total += float64(p) * df
+	}
+	if math.Abs(total-power)/power > 0.05 {
+		t.Errorf("integrated density is %g, want the signal power %g", total, power)
+	}
+
+	// The one-sided density of white noise is flat at 2σ²/fs
+	level := 2 * sigma * sigma / fs
+	var mean float64
+	for _, p := range psd[1 : len(psd)-1] {
+		mean += float64(p)
+	}
+	mean /= float64(len(psd) - 2)
+	if math.Abs(mean-level)/level > 0.05 {
+		t.Errorf("mean density is %g, want %g", mean, level)
+	}
+}
+
+func TestWelchSinusoidPower(t *testing.T) {
+	const fs, n, nfft, amp = 8000.0, 1 << 15, 1024, 0.8
+	// Exactly on bin 100
+	f0 := 100 * fs / nfft
+	x := make([]float32, n)
+	for i := range x {
+		x[i] = float32(amp * math.Sin(2*math.Pi*f0*float64(i)/fs))
+	}
+
+	psd, freqs := Welch(x, fs, WelchOptions{Window: dspsingle.Hann(nfft)})
+
+	peak := 0
+	for k := range psd {
+		if psd[k] > psd[peak] {
+			peak = k
+		}
+	}
+	if float64(freqs[peak]) != f0 {
+		t.Errorf("peak is at %g Hz, want %g Hz", freqs[peak], f0)
+	}
+
+	// The Hann window spreads the sinusoid over the peak and its neighbours
+	df := float64(freqs[1] - freqs[0])
+	var power float64
+	for k := peak - 2; k <= peak+2; k++ {
+		power += float64(psd[k]) * df
+	}
+	if want := amp * amp / 2; math.Abs(power-want)/want > 0.01 {
+		t.Errorf("power around the peak is %g, want %g", power, want)
+	}
+}
@@ -9,5 +9,5 @@ require (
 	github.com/gordonklaus/portaudio v0.0.0-20180817120803-00e7307ccd93
 	github.com/lucasb-eyer/go-colorful v1.0.3
 	github.com/wcharczuk/go-chart v2.0.1+incompatible
-	golang.org/x/image v0.0.0-20200430140353-33d19683fad8 // indirect
+	golang.org/x/image v0.0.0-20200430140353-33d19683fad8
 )
@@ -0,0 +1,1150 @@
+// Package gui is the desktop interface of the visualiser, built on the lcv
+// package with andlabs/ui
+package gui
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/andlabs/ui"
+	_ "github.com/andlabs/ui/winmanifest"
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/nadav-rahimi/led-colour-visualiser"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Box wrapper which surrounds the square changing colour
+var coloured_square *ui.Area
+
+// Random colour generated to be fed to the area handler
+var rand_color = rand.Uint32()
+
+// The handler for drawing a gradient area
+var gh = &gradientareahandler{}
+
+// Label showing the tempo estimated by the analyser
+var tempolabel *ui.Label
+
+// Checkbox which determines whether the custom gradient should be used
+var cgbox *ui.Checkbox
+
+// The combobox which houses the builtin and user gradients
+var gradientcbox *ui.Combobox
+
+// The names of the gradients in gradientcbox, in the order they are shown
+var gradientnames []string
+
+// The box holding gradientcbox, the combobox is replaced when the user
+// gradients change as it cannot be cleared
+var gradientholder *ui.Box
+
+// The combobox for choosing and naming gradients in the user's gradient
+// library, and the box holding it as it is replaced when they change
+var librarycbox *ui.EditableCombobox
+var libraryholder *ui.Box
+
+// The combobox for choosing and naming presets
+var presetcbox *ui.EditableCombobox
+
+// The square which changes colour
+var colored_area = areaHandler{area_color: &rand_color}
+
+// The audio analyser which the ui uses, created by SetupUI
+var aA *lcv.AudioAnalyser
+
+// UI Functions
+func mkSolidBrush(color uint32, alpha float64) *ui.DrawBrush {
+	brush := new(ui.DrawBrush)
+	brush.Type = ui.DrawBrushTypeSolid
+	component := uint8((color >> 16) & 0xFF)
+	brush.R = float64(component) / 255
+	component = uint8((color >> 8) & 0xFF)
+	brush.G = float64(component) / 255
+	component = uint8(color & 0xFF)
+	brush.B = float64(component) / 255
+	brush.A = alpha
+	return brush
+}
+
+// Custom areaHandler interface
+type areaHandler struct {
+	area_color *uint32
+}
+
+func (ah areaHandler) Draw(a *ui.Area, p *ui.AreaDrawParams) {
+	// fill the area with white
+	brush := mkSolidBrush(*ah.area_color, 1.0)
+	path := ui.DrawNewPath(ui.DrawFillModeWinding)
+	path.AddRectangle(0, 0, p.AreaWidth, p.AreaHeight)
+	path.End()
+	p.Context.Fill(path, brush)
+	path.Free()
+}
+
+func (areaHandler) MouseEvent(a *ui.Area, me *ui.AreaMouseEvent) {
+	// do nothing
+	//*current_colour_hex = rand.Uint32()
+	//coloured_square.QueueRedrawAll()
+}
+
+func (areaHandler) MouseCrossed(a *ui.Area, left bool) {
+	// do nothing
+}
+
+func (areaHandler) DragBroken(a *ui.Area) {
+	// do nothing
+}
+
+func (areaHandler) KeyEvent(a *ui.Area, ke *ui.AreaKeyEvent) (handled bool) {
+	// do nothing
+	return false
+}
+
+// Changes the colour of the canvas area based on a uint32 value
+func (ah areaHandler) changeColourUINT32(c uint32) {
+	*ah.area_color = c
+	coloured_square.QueueRedrawAll()
+}
+
+// Updates the tempo label with the tempo and beat phase of a frame, the
+// marker is shown on the first quarter of every beat
+func updateTempoLabel(bpm, phase float64) {
+	if bpm == 0 {
+		tempolabel.SetText("tempo: -- bpm")
+		return
+	}
+
+	marker := ""
+	if phase < 0.25 {
+		marker = "  \u25cf"
+	}
+	tempolabel.SetText(fmt.Sprintf("tempo: %.1f bpm%s", bpm, marker))
+}
+
+// The most stops the gradient creator can edit
+const maxEditorStops = 32
+
+// Gradient handler struct which handles the drawing of blended gradients
+type gradientareahandler struct {
+	isreference bool
+	gt          *lcv.GradientTable
+	// The rows of the stops being edited, in the order they were added
+	stops []*stopRow
+	// The box holding the rows of the stops
+	stopsbox  *ui.Box
+	addbtn    *ui.Button
+	space     lcv.ColourSpace
+	curve     *lcv.FrequencyCurve
+	animation *lcv.GradientAnimation
+	spacecbox *ui.Combobox
+	area      *ui.Area
+	// A loaded gradient with more stops than the creator can edit, used in
+	// place of the stop rows until the gradient is edited
+	full *lcv.GradientTable
+}
+
+// The controls of one stop in the gradient creator
+type stopRow struct {
+	box    *ui.Box
+	colour *ui.ColorButton
+	// Sliders set to 10000 but then when drawing are scaled back down to one
+	// as per the gradient table struct. This allows the slider to have 10000
+	// steps as opposed to simply 0 and 1
+	pos    *ui.Slider
+	easing *ui.Combobox
+	remove *ui.Button
+}
+
+// Adds a row for a stop to the creator, unless it has the most stops it can
+// edit
+func (gh *gradientareahandler) addStop(stop lcv.GradientStop) {
+	if len(gh.stops) >= maxEditorStops {
+		return
+	}
+
+	row := &stopRow{
+		box:    ui.NewHorizontalBox(),
+		colour: ui.NewColorButton(),
+		pos:    ui.NewSlider(0, 10000),
+		easing: ui.NewCombobox(),
+		remove: ui.NewButton("remove"),
+	}
+	row.box.SetPadded(true)
+	row.colour.SetColor(stop.Col.R, stop.Col.G, stop.Col.B, 1)
+	row.pos.SetValue(int(stop.Pos*10000 + 0.5))
+	for i, e := range lcv.Easings() {
+		row.easing.Append(string(e))
+		if e == stop.Easing || (i == 0 && stop.Easing == "") {
+			row.easing.SetSelected(i)
+		}
+	}
+
+	row.colour.OnChanged(func(*ui.ColorButton) { gh.edited() })
+	row.pos.OnChanged(func(*ui.Slider) { gh.edited() })
+	row.easing.OnSelected(func(*ui.Combobox) { gh.edited() })
+	row.remove.OnClicked(func(*ui.Button) {
+		gh.removeStop(row)
+		gh.edited()
+	})
+
+	row.box.Append(row.colour, false)
+	row.box.Append(row.pos, true)
+	row.box.Append(row.easing, false)
+	row.box.Append(row.remove, false)
+	gh.stopsbox.Append(row.box, false)
+	gh.stops = append(gh.stops, row)
+	gh.updateStopButtons()
+}
+
+// Removes the row of a stop from the creator
+func (gh *gradientareahandler) removeStop(row *stopRow) {
+	for i, r := range gh.stops {
+		if r == row {
+			gh.stopsbox.Delete(i)
+			row.box.Destroy()
+			gh.stops = append(gh.stops[:i], gh.stops[i+1:]...)
+			break
+		}
+	}
+	gh.updateStopButtons()
+}
+
+// Allows stops to be removed while there are more than 2 and added while
+// there are fewer than the most the creator can edit
+func (gh *gradientareahandler) updateStopButtons() {
+	for _, r := range gh.stops {
+		if len(gh.stops) > 2 {
+			r.remove.Enable()
+		} else {
+			r.remove.Disable()
+		}
+	}
+	if len(gh.stops) < maxEditorStops {
+		gh.addbtn.Enable()
+	} else {
+		gh.addbtn.Disable()
+	}
+}
+
+// Adds a stop in the middle of the widest gap between the stops, with the
+// colour the gradient has there
+func (gh *gradientareahandler) addStopInGap() {
+	gh.CalculateGradientTable()
+	stops := gh.gt.Stops
+
+	pos, gap := 0.5, 0.0
+	for i := 0; i < len(stops)-1; i++ {
+		if g := stops[i+1].Pos - stops[i].Pos; g > gap {
+			pos, gap = stops[i].Pos+g/2, g
+		}
+	}
+	// Past the ends of the gradient the gap goes to 0 or 1
+	if len(stops) > 0 {
+		if g := stops[0].Pos; g > gap {
+			pos, gap = g/2, g
+		}
+		if g := 1 - stops[len(stops)-1].Pos; g > gap {
+			pos = 1 - g/2
+		}
+	}
+
+	gh.addStop(lcv.GradientStop{Col: gh.gt.GetInterpolatedColorFor(pos), Pos: pos})
+	gh.edited()
+}
+
+// Switches a loaded gradient with more stops than the creator can edit to
+// the stop rows once they are edited
+func (gh *gradientareahandler) edited() {
+	gh.full = nil
+	gh.changed()
+}
+
+// Redraws the gradient after it has been edited and sends it to the
+// analyser if the custom gradient is used
+func (gh *gradientareahandler) changed() {
+	gh.area.QueueRedrawAll()
+	if cgbox.Checked() {
+		gh.CalculateGradientTable()
+		aA.SetGradient(gh.gt)
+	}
+}
+
+// Shows a gradient table in the stop rows of the handler and sends it to
+// the analyser if the custom gradient is used
+func (gh *gradientareahandler) setGradientTable(gt *lcv.GradientTable) {
+	gh.showGradientTable(gt)
+	gh.changed()
+}
+
+// Shows a gradient table in the stop rows of the handler without sending it
+// to the analyser, the creator shows up to maxEditorStops of its stops
+func (gh *gradientareahandler) showGradientTable(gt *lcv.GradientTable) {
+	for len(gh.stops) > 0 {
+		gh.removeStop(gh.stops[len(gh.stops)-1])
+	}
+	for _, stop := range gt.Stops {
+		gh.addStop(stop)
+	}
+	gh.setSpace(gt.Space)
+	// The curve and animation of a loaded gradient are kept as the editor
+	// cannot show them
+	gh.curve = gt.Curve
+	gh.animation = gt.Animation
+	gh.full = nil
+	if len(gt.Stops) > maxEditorStops {
+		gh.full = gt
+	}
+	gh.area.QueueRedrawAll()
+}
+
+// Sets the colour space the gradient is blended in and shows it in the
+// colour space combobox
+func (gh *gradientareahandler) setSpace(space lcv.ColourSpace) {
+	space, err := lcv.ParseColourSpace(string(space))
+	if err != nil {
+		space, _ = lcv.ParseColourSpace("")
+	}
+	gh.space = space
+	for i, s := range lcv.ColourSpaces() {
+		if s == space {
+			gh.spacecbox.SetSelected(i)
+		}
+	}
+}
+
+// Calculates the new gradient table for the area handler from its stop
+// rows, sorted by their positions
+func (gh *gradientareahandler) CalculateGradientTable() {
+	if gh.isreference || gh.stopsbox == nil {
+		return
+	}
+
+	if gh.full != nil {
+		gh.gt = gh.full
+		return
+	}
+
+	stops := make([]lcv.GradientStop, len(gh.stops))
+	for i, row := range gh.stops {
+		r, g, b, _ := row.colour.Color()
+		stops[i] = lcv.GradientStop{
+			Col: colorful.Color{R: r, G: g, B: b},
+			Pos: float64(row.pos.Value()) / 10000,
+		}
+		if e := row.easing.Selected(); e > 0 {
+			stops[i].Easing = lcv.Easings()[e]
+		}
+	}
+	sort.SliceStable(stops, func(i, j int) bool {
+		return stops[i].Pos < stops[j].Pos
+	})
+	gh.gt = &lcv.GradientTable{Stops: stops, Space: gh.space, Curve: gh.curve, Animation: gh.animation}
+}
+
+func (gh gradientareahandler) Draw(a *ui.Area, p *ui.AreaDrawParams) {
+	//fmt.Println("keep this print comment here")
+	gh.CalculateGradientTable()
+
+	for x := p.AreaWidth - 1; x >= 0; x-- {
+		c := lcv.ColourUINT32(gh.gt.GetInterpolatedColorFor(float64(x) / float64(p.AreaWidth)))
+		brush := mkSolidBrush(c, 1.0)
+
+		path := ui.DrawNewPath(ui.DrawFillModeAlternate)
+		path.AddRectangle(0, 0, float64(x+1), p.AreaHeight)
+		path.End()
+		p.Context.Fill(path, brush)
+		path.Free()
+	}
+}
+
+func (gradientareahandler) MouseEvent(a *ui.Area, me *ui.AreaMouseEvent) {
+	// do nothing
+	//*current_colour_hex = rand.Uint32()
+	//coloured_square.QueueRedrawAll()
+}
+
+func (gradientareahandler) MouseCrossed(a *ui.Area, left bool) {
+	// do nothing
+}
+
+func (gradientareahandler) DragBroken(a *ui.Area) {
+	// do nothing
+}
+
+func (gradientareahandler) KeyEvent(a *ui.Area, ke *ui.AreaKeyEvent) (handled bool) {
+	// do nothing
+	return false
+}
+
+// Constructs the widgets for the visualisation page of the gui
+func makeVisualisationPage(mainwin *ui.Window) ui.Control {
+	// Create the hbox for the visualiser
+	hbox := ui.NewHorizontalBox()
+	hbox.SetPadded(true)
+
+	// Vbox for the program settings
+	vbox := ui.NewVerticalBox()
+	vbox.SetPadded(true)
+	hbox.Append(vbox, false)
+
+	// Adding the visualiser and the tempo below it to the hbox
+	visbox := ui.NewVerticalBox()
+	visbox.SetPadded(true)
+	coloured_square = ui.NewArea(colored_area)
+	visbox.Append(coloured_square, true)
+	tempolabel = ui.NewLabel("tempo: -- bpm")
+	visbox.Append(tempolabel, false)
+	hbox.Append(visbox, true)
+
+	// execution controls label
+	vbox.Append(ui.NewLabel("main controls:"), false)
+
+	// Button to start visualisation
+	visualise_button := ui.NewButton("start")
+	vbox.Append(visualise_button, false)
+
+	// Button to stop visualisation
+	stop_button := ui.NewButton("stop")
+	vbox.Append(stop_button, false)
+
+	// Gradient combobox
+	vbox.Append(ui.NewLabel("gradients:"), false)
+	gradientholder = ui.NewVerticalBox()
+	fillGradients(mainwin, aA.Snapshot().GradientName)
+	vbox.Append(gradientholder, false)
+
+	// Audio device combobox
+	vbox.Append(ui.NewLabel("audio device:"), false)
+	devicecbox := ui.NewCombobox()
+	devices, err := lcv.InputDevices()
+	if err != nil {
+		ui.MsgBoxError(mainwin, "Audio devices", err.Error())
+	}
+	for i, name := range devices {
+		devicecbox.Append(name)
+		if strings.HasPrefix(name, aA.Snapshot().InputDevice) {
+			devicecbox.SetSelected(i)
+		}
+	}
+	devicecbox.OnSelected(func(c *ui.Combobox) {
+		aA.SetInputDevice(devices[devicecbox.Selected()])
+	})
+	if devicecbox.Selected() >= 0 {
+		aA.SetInputDevice(devices[devicecbox.Selected()])
+	}
+	vbox.Append(devicecbox, false)
+
+	// Options hbox
+	vbox.Append(ui.NewLabel("visualisation options:"), false)
+	optionshbox := ui.NewVerticalBox()
+	hbox.SetPadded(true)
+	vbox.Append(optionshbox, false)
+
+	// The checkboxes start from the analyser's current settings
+	snap := aA.Snapshot()
+
+	// Smoothing Checkbox
+	smoothbox := ui.NewCheckbox("smoothing")
+	if snap.Filter.Smooth {
+		smoothbox.SetChecked(true)
+	}
+	smoothbox.OnToggled(func(c *ui.Checkbox) {
+		fp := aA.Snapshot().Filter
+		fp.Smooth = c.Checked()
+		if err := aA.SetFilterParams(fp); err != nil {
+			ui.MsgBoxError(mainwin, "Smoothing", err.Error())
+			c.SetChecked(!c.Checked())
+		}
+	})
+	optionshbox.Append(smoothbox, false)
+
+	// Dampening Checkbox
+	dampbox := ui.NewCheckbox("dampening")
+	if snap.Filter.Damp {
+		dampbox.SetChecked(true)
+	}
+	dampbox.OnToggled(func(c *ui.Checkbox) {
+		fp := aA.Snapshot().Filter
+		fp.Damp = c.Checked()
+		if err := aA.SetFilterParams(fp); err != nil {
+			ui.MsgBoxError(mainwin, "Dampening", err.Error())
+			c.SetChecked(!c.Checked())
+		}
+	})
+	optionshbox.Append(dampbox, false)
+
+	// Spectrogram Checkbox
+	specbox := ui.NewCheckbox("save spectrogram on stop")
+	if snap.Spectrogram {
+		specbox.SetChecked(true)
+	}
+	specbox.OnToggled(func(c *ui.Checkbox) {
+		aA.SetSpectrogram(c.Checked())
+	})
+	optionshbox.Append(specbox, false)
+
+	// Mains Hum Filter Checkbox
+	humbox := ui.NewCheckbox("filter mains hum (50 Hz)")
+	if snap.Filter.HumF > 0 {
+		humbox.SetChecked(true)
+	}
+	humbox.OnToggled(func(c *ui.Checkbox) {
+		fp := aA.Snapshot().Filter
+		fp.HumF = 0
+		if c.Checked() {
+			fp.HumF = 50
+		}
+		if err := aA.SetFilterParams(fp); err != nil {
+			ui.MsgBoxError(mainwin, "Mains hum filter", err.Error())
+			c.SetChecked(!c.Checked())
+		}
+	})
+	optionshbox.Append(humbox, false)
+
+	// Custom Gradient Checkbox
+	cgbox = ui.NewCheckbox("custom gradient")
+	if snap.Gradient != nil && snap.GradientName == "" {
+		cgbox.SetChecked(true)
+	}
+	cgbox.OnToggled(func(c *ui.Checkbox) {
+		if c.Checked() {
+			gh.CalculateGradientTable()
+			aA.SetGradient(gh.gt)
+		} else if err := aA.SetGradientName(selectedGradient()); err != nil {
+			ui.MsgBoxError(mainwin, "Gradient", err.Error())
+		}
+	})
+	optionshbox.Append(cgbox, false)
+
+	// Option to decide whether to send data over a udp connection to a localhost websocket
+	vbox.Append(ui.NewLabel("connection options:"), false)
+	udpledcntrl := ui.NewCheckbox("send data to led lights") // TODO underline or bold the heading text
+	if len(snap.Outputs) > 0 && snap.Outputs[0].Enabled {
+		udpledcntrl.SetChecked(true)
+	}
+	udpledcntrl.OnToggled(func(c *ui.Checkbox) {
+		// The analyser connects to the lights when it is running
+		outputs := aA.Snapshot().Outputs
+		for i := range outputs {
+			outputs[i].Enabled = c.Checked()
+		}
+		if err := aA.SetOutputs(outputs); err != nil {
+			ui.MsgBoxError(mainwin, "Connection", err.Error())
+		}
+	})
+	vbox.Append(udpledcntrl, false)
+
+	// Slider capping the brightness of the lights, the square is not dimmed
+	vbox.Append(ui.NewLabel("led brightness (%):"), false)
+	brightslider := ui.NewSlider(1, 100)
+	brightslider.SetValue(int(snap.Params.Brightness*100 + 0.5))
+	brightslider.OnChanged(func(s *ui.Slider) {
+		p := aA.Snapshot().Params
+		p.Brightness = float64(s.Value()) / 100
+		if err := aA.SetParams(p); err != nil {
+			ui.MsgBoxError(mainwin, "Brightness", err.Error())
+		}
+	})
+	vbox.Append(brightslider, false)
+
+	// Presets, a preset is applied to the running analyser without
+	// restarting it and the current settings can be saved under a new name
+	vbox.Append(ui.NewLabel("presets:"), false)
+	presetnames, err := presets.Names()
+	if err != nil {
+		ui.MsgBoxError(mainwin, "Presets", err.Error())
+	}
+	presetcbox = ui.NewEditableCombobox()
+	for _, name := range presetnames {
+		presetcbox.Append(name)
+	}
+	vbox.Append(presetcbox, false)
+	presetbox := ui.NewHorizontalBox()
+	presetbox.SetPadded(true)
+	applypresetbtn := ui.NewButton("apply")
+	applypresetbtn.OnClicked(func(b *ui.Button) {
+		cfg, err := presets.Load(presetcbox.Text())
+		if err == nil {
+			err = aA.ApplyConfig(cfg)
+		}
+		if err != nil {
+			ui.MsgBoxError(mainwin, "Unable to apply preset", err.Error())
+			return
+		}
+		showSettings()
+	})
+	presetbox.Append(applypresetbtn, true)
+	savepresetbtn := ui.NewButton("save")
+	savepresetbtn.OnClicked(func(b *ui.Button) {
+		name := presetcbox.Text()
+		if err := presets.Save(name, aA.Config()); err != nil {
+			ui.MsgBoxError(mainwin, "Unable to save preset", err.Error())
+			return
+		}
+		if stringpos(presetnames, name) == -1 {
+			presetnames = append(presetnames, name)
+			presetcbox.Append(name)
+		}
+	})
+	presetbox.Append(savepresetbtn, true)
+	vbox.Append(presetbox, false)
+
+	// Shows the analyser's current settings in the controls after they have
+	// been changed all at once
+	showSettings = func() {
+		snap := aA.Snapshot()
+		if i := stringpos(gradientnames, snap.GradientName); i != -1 {
+			gradientcbox.SetSelected(i)
+		}
+		custom := snap.Gradient != nil && snap.GradientName == ""
+		cgbox.SetChecked(custom)
+		if custom {
+			gh.showGradientTable(snap.Gradient)
+		}
+		smoothbox.SetChecked(snap.Filter.Smooth)
+		dampbox.SetChecked(snap.Filter.Damp)
+		specbox.SetChecked(snap.Spectrogram)
+		humbox.SetChecked(snap.Filter.HumF > 0)
+		udpledcntrl.SetChecked(len(snap.Outputs) > 0 && snap.Outputs[0].Enabled)
+		brightslider.SetValue(int(snap.Params.Brightness*100 + 0.5))
+	}
+
+	// Saves the current settings to the config file
+	savebtn := ui.NewButton("save settings")
+	savebtn.OnClicked(func(b *ui.Button) {
+		var err error
+		if ConfigPath != "" {
+			err = aA.Config().Save(ConfigPath)
+		} else {
+			err = saveState(currentState())
+		}
+		if err != nil {
+			ui.MsgBoxError(mainwin, "Unable to save settings", err.Error())
+		}
+	})
+	vbox.Append(savebtn, false)
+
+	// Defined here so the devicebox variable is in scope meaning it can be disabled on start of analysis
+	visualise_button.OnClicked(func(b *ui.Button) {
+		if err := aA.Start(context.Background()); err != nil {
+			if !errors.Is(err, lcv.ErrAlreadyRunning) {
+				ui.MsgBoxError(mainwin, "Unable to start", err.Error())
+			}
+			return
+		}
+		devicecbox.Disable()
+
+		// The device can be changed again once the analysis has ended, any
+		// error which ended it is shown
+		go func() {
+			err := aA.Wait()
+			ui.QueueMain(func() {
+				devicecbox.Enable()
+				if err != nil {
+					ui.MsgBoxError(mainwin, "Analysis stopped", err.Error())
+				}
+			})
+		}()
+	})
+	stop_button.OnClicked(func(b *ui.Button) {
+		// Stopping waits for the graphs to render so it is kept off the ui thread
+		go aA.Stop()
+	})
+
+	return hbox
+}
+
+// Constructs the widgets for creating custom gradients
+func makeGradientPage(mainwin *ui.Window) ui.Control {
+	vbox := ui.NewVerticalBox()
+	vbox.SetPadded(true)
+
+	// Reference visualisation for the starboy gradient
+	starboy, _ := lcv.GradientByName("starboy")
+	rh := &gradientareahandler{
+		gt:          starboy,
+		isreference: true,
+	}
+	referencevis := ui.NewArea(rh)
+
+	// The visualisation of the user created gradient
+	gradientvis := ui.NewArea(gh)
+
+	// Combobox which controls the colour space the colours are blended in
+	spacebox := ui.NewHorizontalBox()
+	spacecbox := ui.NewCombobox()
+	for _, space := range lcv.ColourSpaces() {
+		spacecbox.Append(string(space))
+	}
+	spacecbox.OnSelected(func(c *ui.Combobox) {
+		gh.space = lcv.ColourSpaces()[c.Selected()]
+		// The colours of a gradient too big to edit are kept in the new space
+		if gh.full != nil {
+			full := *gh.full
+			full.Space = gh.space
+			gh.full = &full
+		}
+		gh.changed()
+	})
+	spacebox.Append(ui.NewLabel("colour space to blend the colours in:"), true)
+	spacebox.Append(spacecbox, true)
+
+	vbox.Append(referencevis, true)
+	vbox.Append(gradientvis, true)
+
+	// The rows of the stops, each with its colour, its position and how it
+	// blends into the next stop
+	stopsheader := ui.NewHorizontalBox()
+	stopsheader.SetPadded(true)
+	stopsheader.Append(ui.NewLabel("colour"), false)
+	stopsheader.Append(ui.NewLabel("position"), true)
+	stopsheader.Append(ui.NewLabel("easing to the next colour"), false)
+	stopsbox := ui.NewVerticalBox()
+	stopsbox.SetPadded(true)
+
+	// Button which adds a stop in the widest gap of the gradient
+	addbox := ui.NewHorizontalBox()
+	addbtn := ui.NewButton("  add colour  ")
+	addbtn.OnClicked(func(b *ui.Button) {
+		gh.addStopInGap()
+	})
+	addbox.Append(ui.NewLabel(fmt.Sprintf("up to %d colours", maxEditorStops)), true)
+	addbox.Append(addbtn, false)
+
+	// Populates the gradient handler with its controls and the stops it
+	// starts with
+	gh.stopsbox = stopsbox
+	gh.addbtn = addbtn
+	gh.spacecbox = spacecbox
+	gh.area = gradientvis
+	gh.setSpace(gh.space)
+	gh.addStop(lcv.GradientStop{Col: lcv.MustParseHex("#ff0000"), Pos: 0})
+	gh.addStop(lcv.GradientStop{Col: lcv.MustParseHex("#00ff00"), Pos: 0.5})
+	gh.addStop(lcv.GradientStop{Col: lcv.MustParseHex("#0000ff"), Pos: 1})
+
+	vbox.Append(stopsheader, false)
+	vbox.Append(stopsbox, false)
+	vbox.Append(addbox, false)
+	vbox.Append(spacebox, false)
+	vbox.Append(ui.NewHorizontalSeparator(), false)
+
+	// Gradient saving/loading section
+	gradsavingbox := ui.NewHorizontalBox()
+	gradsavingbox.SetPadded(true)
+
+	// Button to load a gradient from the file
+	loadbtn := ui.NewButton("  load gradient from file  ")
+	loadbtn.OnClicked(func(b *ui.Button) {
+		filename := ui.OpenFile(mainwin)
+
+		if filename == "" {
+			return
+		}
+
+		gt, err := lcv.ImportGradient(filename)
+		if err != nil {
+			ui.MsgBoxError(mainwin, "Unable to load gradient", err.Error())
+			return
+		}
+		gh.setGradientTable(gt)
+
+		// Palettes from other programs are named after their file for the
+		// library's save button, unless a gradient already has the name
+		if strings.ToLower(filepath.Ext(filename)) == ".json" {
+			return
+		}
+		name := lcv.ImportedGradientName(filename)
+		msg := fmt.Sprintf("Save the gradient to the library to add it to the gradient list as %q.", name)
+		for _, existing := range lcv.GradientNames() {
+			if existing == name {
+				msg = fmt.Sprintf("A gradient is already named %q, choose another name to save it to the library.", name)
+				name = ""
+				break
+			}
+		}
+		librarycbox.SetText(name)
+		if len(gt.Stops) > maxEditorStops {
+			msg += fmt.Sprintf(" All %d of its colours are kept until the colours are edited, the creator only shows the first %d.", len(gt.Stops), maxEditorStops)
+		}
+		ui.MsgBox(mainwin, "Gradient imported", msg)
+	})
+	savebtn := ui.NewButton("  save gradient to file  ")
+	savebtn.OnClicked(func(b *ui.Button) {
+		filename := ui.SaveFile(mainwin)
+		if filename == "" {
+			return
+		}
+
+		i := strings.Index(filename, ".")
+		if i != -1 {
+			filename = strings.Split(filename, ".")[0]
+		}
+		filename += ".json"
+
+		// Calculates the gradient table to ensure no logic error occurs
+		gh.CalculateGradientTable()
+
+		file, err := json.MarshalIndent(*gh.gt, "", " ")
+		if err == nil {
+			err = ioutil.WriteFile(filename, file, 0644)
+		}
+		if err != nil {
+			ui.MsgBoxError(mainwin, "Unable to save gradient", err.Error())
+		}
+
+	})
+	gradsavingbox.Append(ui.NewLabel(""), true)
+	gradsavingbox.Append(loadbtn, false)
+	gradsavingbox.Append(savebtn, false)
+
+	vbox.Append(gradsavingbox, false)
+
+	// Gradient library section, the gradients saved to it are listed with
+	// the builtin gradients on the visualisation page
+	librarybox := ui.NewHorizontalBox()
+	librarybox.SetPadded(true)
+	librarybox.Append(ui.NewLabel("gradient library:"), false)
+	libraryholder = ui.NewVerticalBox()
+	fillLibrary()
+	librarybox.Append(libraryholder, true)
+
+	openlibbtn := ui.NewButton("open")
+	openlibbtn.OnClicked(func(b *ui.Button) {
+		gt, err := lcv.GradientByName(librarycbox.Text())
+		if err != nil {
+			ui.MsgBoxError(mainwin, "Unable to open gradient", err.Error())
+			return
+		}
+		gh.setGradientTable(gt)
+	})
+	savelibbtn := ui.NewButton("save")
+	savelibbtn.OnClicked(func(b *ui.Button) {
+		name := librarycbox.Text()
+		gh.CalculateGradientTable()
+		if err := lcv.SaveGradient(GradientDir, name, gh.gt); err != nil {
+			ui.MsgBoxError(mainwin, "Unable to save gradient", err.Error())
+			return
+		}
+		reloadGradients(mainwin, selectedGradient())
+		librarycbox.SetText(name)
+	})
+	deletelibbtn := ui.NewButton("delete")
+	deletelibbtn.OnClicked(func(b *ui.Button) {
+		if err := lcv.DeleteGradient(GradientDir, librarycbox.Text()); err != nil {
+			ui.MsgBoxError(mainwin, "Unable to delete gradient", err.Error())
+			return
+		}
+		reloadGradients(mainwin, selectedGradient())
+		librarycbox.SetText("")
+	})
+	librarybox.Append(openlibbtn, false)
+	librarybox.Append(savelibbtn, false)
+	librarybox.Append(deletelibbtn, false)
+
+	// Renames the gradient named in the library combobox
+	renamebox := ui.NewHorizontalBox()
+	renamebox.SetPadded(true)
+	renameentry := ui.NewEntry()
+	renamebtn := ui.NewButton("rename")
+	renamebtn.OnClicked(func(b *ui.Button) {
+		from, to := librarycbox.Text(), renameentry.Text()
+		if err := lcv.RenameGradient(GradientDir, from, to); err != nil {
+			ui.MsgBoxError(mainwin, "Unable to rename gradient", err.Error())
+			return
+		}
+		// A selected gradient stays selected under its new name
+		selected := selectedGradient()
+		if selected == from {
+			selected = to
+		}
+		reloadGradients(mainwin, selected)
+		librarycbox.SetText(to)
+		renameentry.SetText("")
+	})
+	renamebox.Append(ui.NewLabel("rename the library gradient to:"), false)
+	renamebox.Append(renameentry, true)
+	renamebox.Append(renamebtn, false)
+
+	vbox.Append(librarybox, false)
+	vbox.Append(renamebox, false)
+
+	return vbox
+}
+
+// A config file the settings are loaded from when the gui starts instead of
+// the saved gui state, the save settings button saves to it if it is set
+var ConfigPath = ""
+
+// The directory the presets are stored in, the default preset directory is
+// used if it is empty
+var PresetDir = ""
+
+// The directory of the user gradients, the default gradient directory is
+// used if it is empty
+var GradientDir = ""
+
+// The address the analyser's metrics are served on at /debug/vars, they are
+// not served if it is empty
+var MetricsAddr = ""
+
+// The presets shown on the visualisation page
+var presets *lcv.PresetStore
+
+// Updates the controls of the visualisation page to the analyser's settings
+var showSettings = func() {}
+
+// Replaces gradientcbox with a combobox listing the current gradients, with
+// the named gradient selected or "default" if it no longer exists
+func fillGradients(mainwin *ui.Window, selectedName string) {
+	if gradientcbox != nil {
+		gradientholder.Delete(0)
+	}
+
+	gradientnames = lcv.GradientNames()
+	gradientcbox = ui.NewCombobox()
+	for _, name := range gradientnames {
+		gradientcbox.Append(name)
+	}
+	selected := stringpos(gradientnames, selectedName)
+	if selected == -1 {
+		selected = stringpos(gradientnames, "default")
+	}
+	gradientcbox.SetSelected(selected)
+	gradientcbox.OnSelected(func(c *ui.Combobox) {
+		// The custom gradient takes priority over the selected gradient
+		if !cgbox.Checked() {
+			if err := aA.SetGradientName(gradientnames[gradientcbox.Selected()]); err != nil {
+				ui.MsgBoxError(mainwin, "Gradient", err.Error())
+			}
+		}
+	})
+	gradientholder.Append(gradientcbox, false)
+
+	fillLibrary()
+}
+
+// Replaces librarycbox with a combobox listing the user gradients, keeping
+// the name typed into it
+func fillLibrary() {
+	if libraryholder == nil {
+		return
+	}
+	text := ""
+	if librarycbox != nil {
+		text = librarycbox.Text()
+		libraryholder.Delete(0)
+	}
+
+	librarycbox = ui.NewEditableCombobox()
+	for _, name := range lcv.UserGradientNames() {
+		librarycbox.Append(name)
+	}
+	librarycbox.SetText(text)
+	libraryholder.Append(librarycbox, false)
+}
+
+// Returns the name of the gradient selected in gradientcbox
+func selectedGradient() string {
+	if i := gradientcbox.Selected(); i >= 0 {
+		return gradientnames[i]
+	}
+	return "default"
+}
+
+// Shows the current gradients in the gradient comboboxes with the named
+// gradient selected. If the selection changes, such as when the selected
+// gradient was removed, the analyser switches to the new selection unless
+// the custom gradient is used
+func showGradients(mainwin *ui.Window, selectedName string) {
+	previous := selectedGradient()
+	fillGradients(mainwin, selectedName)
+	if current := selectedGradient(); current != previous && !cgbox.Checked() {
+		if err := aA.SetGradientName(current); err != nil {
+			ui.MsgBoxError(mainwin, "Gradient", err.Error())
+		}
+	}
+}
+
+// Reloads the user gradients after the library has been changed from the gui
+// and shows them
+func reloadGradients(mainwin *ui.Window, selectedName string) {
+	if err := lcv.LoadGradientDir(GradientDir); err != nil {
+		ui.MsgBoxError(mainwin, "Unable to load gradients", err.Error())
+	}
+	showGradients(mainwin, selectedName)
+}
+
+// Reloads the config file and the user gradients while the gui is open,
+// applying changes to the analyser and showing them in the controls
+func watchFiles(ctx context.Context, mainwin *ui.Window) {
+	r := lcv.NewReloader(aA, ConfigPath, GradientDir)
+	r.OnGradients = func(err error) {
+		if err != nil {
+			lcv.DefaultLogger().Warn("reloading the gradients", "dir", GradientDir, "err", err)
+		} else {
+			lcv.DefaultLogger().Info("reloaded the gradients", "dir", GradientDir)
+		}
+		ui.QueueMain(func() {
+			// A removed gradient is replaced by the default colouring
+			showGradients(mainwin, selectedGradient())
+			if err != nil {
+				ui.MsgBoxError(mainwin, "Unable to load gradients", err.Error())
+			}
+		})
+	}
+	r.OnConfig = func(err error) {
+		if err != nil {
+			lcv.DefaultLogger().Warn("reloading the settings, keeping the previous settings", "file", ConfigPath, "err", err)
+		} else {
+			lcv.DefaultLogger().Info("reloaded the settings", "file", ConfigPath)
+		}
+		ui.QueueMain(func() {
+			if err != nil {
+				ui.MsgBoxError(mainwin, "Unable to reload settings", err.Error()+"\n\nThe previous settings are kept.")
+				return
+			}
+			showSettings()
+		})
+	}
+	r.Run(ctx)
+}
+
+// Initialises and constructs the UI window
+func SetupUI() {
+	// The gui starts as it was when it was last closed
+	state, stateErr := loadState()
+
+	// Create the main UI window
+	windowWidth, windowHeight = state.WindowWidth, state.WindowHeight
+	mainwin := ui.NewWindow("LED Colour Visualiser", windowWidth, windowHeight, false)
+	if stateErr != nil {
+		ui.MsgBoxError(mainwin, "Unable to restore the last session", stateErr.Error())
+	}
+
+	// The settings come from the config file instead if one is given, an
+	// invalid file is reported and the saved settings are used instead
+	cfg := state.Analyser
+	if ConfigPath != "" {
+		loaded, err := lcv.LoadConfig(ConfigPath)
+		switch {
+		case err == nil:
+			cfg = loaded
+		case !os.IsNotExist(err):
+			ui.MsgBoxError(mainwin, "Unable to load settings", err.Error())
+		}
+	}
+
+	var err error
+
+	if PresetDir == "" {
+		if PresetDir, err = lcv.DefaultPresetDir(); err != nil {
+			ui.MsgBoxError(mainwin, "Presets", err.Error())
+			PresetDir = "presets"
+		}
+	}
+	presets = lcv.NewPresetStore(PresetDir)
+
+	// The user gradients are loaded before the analyser so the settings can
+	// name one, gradients which are invalid are left out
+	if GradientDir == "" {
+		if GradientDir, err = lcv.DefaultGradientDir(); err != nil {
+			ui.MsgBoxError(mainwin, "Gradients", err.Error())
+			GradientDir = "gradients"
+		}
+	}
+	if err := lcv.LoadGradientDir(GradientDir); err != nil {
+		ui.MsgBoxError(mainwin, "Unable to load gradients", err.Error())
+	}
+
+	// The analyser draws the colour of every frame on the square
+	drawFrames := lcv.WithFrameCallback(func(f lcv.Frame) {
+		// The callback runs on the analysis goroutine, the controls are
+		// only changed on the ui thread
+		ui.QueueMain(func() {
+			colored_area.changeColourUINT32(f.Colour)
+			updateTempoLabel(f.BPM, f.BeatPhase)
+		})
+	})
+	aA, err = lcv.New(lcv.WithConfig(cfg), drawFrames)
+	if err != nil {
+		// Settings the analyser cannot use are reported and the gui starts
+		// with the default settings instead
+		lcv.DefaultLogger().Error("creating the analyser", "err", err)
+		ui.MsgBoxError(mainwin, "Unable to use the settings", err.Error()+"\n\nThe default settings are used instead.")
+		cfg = lcv.DefaultConfig()
+		if aA, err = lcv.New(lcv.WithConfig(cfg), drawFrames); err != nil {
+			lcv.DefaultLogger().Error("creating the analyser", "err", err)
+			ui.Quit()
+			return
+		}
+	}
+
+	// The metrics are served as json by expvar
+	if MetricsAddr != "" {
+		if err := aA.PublishMetrics("analyser"); err != nil {
+			lcv.DefaultLogger().Error("publishing the metrics", "err", err)
+		}
+		go func() {
+			if err := http.ListenAndServe(MetricsAddr, nil); err != nil {
+				lcv.DefaultLogger().Error("serving the metrics", "err", err)
+			}
+		}()
+	}
+
+	// The config file and gradients are watched until the gui closes
+	ctx, stopWatching := context.WithCancel(context.Background())
+	go watchFiles(ctx, mainwin)
+
+	// The state is saved as the gui closes
+	closing := func() {
+		stopWatching()
+		aA.Stop()
+		if err := saveState(currentState()); err != nil {
+			lcv.DefaultLogger().Error("saving the gui state", "err", err)
+		}
+		mainwin.Destroy()
+	}
+
+	mainwin.SetMargined(true)
+	mainwin.OnClosing(func(*ui.Window) bool {
+		closing()
+		ui.Quit()
+		return false
+	})
+	ui.OnShouldQuit(func() bool {
+		closing()
+		return true
+	})
+
+	tab := ui.NewTab()
+	mainwin.SetChild(tab)
+	mainwin.SetMargined(true)
+
+	tab.Append("Visualisation", makeVisualisationPage(mainwin))
+	tab.SetMargined(0, true)
+
+	// The main window is passed for the open and save file dialogs
+	tab.Append("Gradient Creator", makeGradientPage(mainwin))
+	tab.SetMargined(1, true)
+
+	restoreState(state)
+
+	mainwin.Show()
+}
+
+// Returns the index of a string in a string slice, -1 returned if not found
+func stringpos(s []string, value string) int {
+	for p, v := range s {
+		if v == value {
+			return p
+		}
+	}
+	return -1
+}
@@ -0,0 +1,149 @@
+package gui
+
+import (
+	"encoding/json"
+	"github.com/nadav-rahimi/led-colour-visualiser"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// The file the gui state is kept in, inside the user's config directory
+const stateFileName = "gui.json"
+
+// The file the gui state is saved to when the gui closes and restored from
+// when it starts, the file in the user's config directory is used if it is
+// empty
+var StatePath = ""
+
+// The size the window was created with, from the restored state. The ui
+// package cannot report the size of a window once it has been created, so
+// this is the size saved
+var windowWidth, windowHeight int
+
+// The state of the gui which is restored when it is next started
+type guiState struct {
+	// Every setting of the analyser
+	Analyser lcv.Config `json:"analyser"`
+	// The gradient selected in the combobox, kept as the analyser does not
+	// know it while the custom gradient is used
+	Gradient string `json:"gradient"`
+	// Whether the custom gradient is used
+	CustomGradient bool `json:"customGradient"`
+	// The colour boxes and sliders of the gradient creator
+	Editor editorState `json:"editor"`
+	// The preset last applied or saved
+	Preset string `json:"preset"`
+	// The size the window is created with
+	WindowWidth  int `json:"windowWidth"`
+	WindowHeight int `json:"windowHeight"`
+}
+
+// The state of the gradient creator
+type editorState struct {
+	// The gradient being edited, nil if the creator has never been used
+	Gradient *lcv.GradientTable `json:"gradient,omitempty"`
+}
+
+// Returns the state the gui starts with when nothing has been saved
+func defaultState() guiState {
+	return guiState{
+		Analyser:     lcv.DefaultConfig(),
+		Gradient:     "default",
+		WindowWidth:  625,
+		WindowHeight: 480,
+	}
+}
+
+// Returns the path of the state file
+func statePath() (string, error) {
+	if StatePath != "" {
+		return StatePath, nil
+	}
+	dir, err := lcv.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, stateFileName), nil
+}
+
+// Reads the saved gui state, the default state is returned along with the
+// error if it cannot be read. A missing file is not an error
+func loadState() (guiState, error) {
+	state := defaultState()
+
+	path, err := statePath()
+	if err != nil {
+		return state, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return state, err
+	}
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return defaultState(), err
+	}
+	if err := state.Analyser.Validate(); err != nil {
+		state.Analyser = lcv.DefaultConfig()
+		return state, err
+	}
+	if state.WindowWidth <= 0 || state.WindowHeight <= 0 {
+		state.WindowWidth, state.WindowHeight = defaultState().WindowWidth, defaultState().WindowHeight
+	}
+
+	return state, nil
+}
+
+// Writes the gui state to the state file, creating its directory if needed
+func saveState(state guiState) error {
+	path, err := statePath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return lcv.WriteFileAtomic(path, append(data, '\n'))
+}
+
+// Collects the current state of the gui and the analyser
+func currentState() guiState {
+	state := guiState{
+		Analyser:       aA.Config(),
+		Gradient:       selectedGradient(),
+		CustomGradient: cgbox.Checked(),
+		Preset:         presetcbox.Text(),
+		WindowWidth:    windowWidth,
+		WindowHeight:   windowHeight,
+	}
+
+	gh.CalculateGradientTable()
+	state.Editor.Gradient = gh.gt
+
+	return state
+}
+
+// Restores the controls which do not follow from the analyser's settings
+func restoreState(state guiState) {
+	if i := stringpos(gradientnames, state.Gradient); i != -1 {
+		gradientcbox.SetSelected(i)
+	}
+	presetcbox.SetText(state.Preset)
+
+	// The creator is only shown, the analyser keeps the gradient of its
+	// config until the creator is edited
+	if gt := state.Editor.Gradient; gt != nil {
+		gh.showGradientTable(gt)
+	} else if snap := aA.Snapshot(); snap.Gradient != nil && snap.GradientName == "" {
+		// A custom gradient from a config file is shown in the gradient creator
+		gh.showGradientTable(snap.Gradient)
+	}
+	cgbox.SetChecked(state.CustomGradient)
+}
@@ -0,0 +1,105 @@
+package lcv
+
+import (
+	"fmt"
+	"github.com/lucasb-eyer/go-colorful"
+	"math"
+)
+
+// Makes a gradient change over time, so a long sustained note does not hold
+// the lights on one colour. The effects can be combined, the keyframes are
+// crossfaded first, then the positions are scrolled and then the hue is
+// shifted
+type GradientAnimation struct {
+	// The fraction of the gradient the positions scroll by each second,
+	// wrapping around from the end of the gradient to its start. Negative
+	// speeds scroll the other way
+	Scroll float64 `json:"scroll,omitempty"`
+	// The degrees the hue of the colours is rotated by each second, keeping
+	// their lightness and chroma
+	HueShift float64 `json:"hueShift,omitempty"`
+	// Gradients the gradient crossfades to in turn before fading back to
+	// itself. Their stops and colour space are used, not their curves
+	Keyframes []GradientTable `json:"keyframes,omitempty"`
+	// The seconds each crossfade from one keyframe to the next takes
+	Period float64 `json:"period,omitempty"`
+	// Runs the animation in beats of the music instead of seconds, so the
+	// scroll and hue shift are per beat and each crossfade takes period
+	// beats and starts on a beat
+	Beats bool `json:"beats,omitempty"`
+}
+
+// Returns a description of each problem with a gradient animation
+func animationProblems(field string, a *GradientAnimation) []string {
+	var problems []string
+	finite := func(v float64) bool {
+		return !math.IsNaN(v) && !math.IsInf(v, 0)
+	}
+
+	if !finite(a.Scroll) {
+		problems = append(problems, fmt.Sprintf("%s.scroll: must be a number, got %g", field, a.Scroll))
+	}
+	if !finite(a.HueShift) {
+		problems = append(problems, fmt.Sprintf("%s.hueShift: must be a number, got %g", field, a.HueShift))
+	}
+	if len(a.Keyframes) > 0 && !(a.Period > 0 && finite(a.Period)) {
+		problems = append(problems, fmt.Sprintf("%s.period: must be positive when there are keyframes, got %g", field, a.Period))
+	}
+	for i := range a.Keyframes {
+		kf := &a.Keyframes[i]
+		name := fmt.Sprintf("%s.keyframes[%d]", field, i)
+		if kf.Animation != nil {
+			problems = append(problems, name+".animation: keyframes cannot be animated")
+		}
+		problems = append(problems, gradientProblems(name, kf)...)
+	}
+
+	return problems
+}
+
+// Returns the colour of the gradient at a position, seconds and beats after
+// the animation started. Only one of them is used, beats if the animation is
+// in beats. Without an animation it is the same at every time
+func (self GradientTable) ColourAt(pos, seconds, beats float64) colorful.Color {
+	a := self.Animation
+	if a == nil {
+		return self.GetInterpolatedColorFor(pos)
+	}
+	if a.Beats {
+		seconds = beats
+	}
+
+	if a.Scroll != 0 {
+		pos = pos + a.Scroll*seconds
+		pos -= math.Floor(pos)
+	}
+
+	col := self.GetInterpolatedColorFor(pos)
+	if n := len(a.Keyframes) + 1; n > 1 {
+		// The gradient is the first frame of the sequence
+		frame := func(i int) GradientTable {
+			if i == 0 {
+				return self
+			}
+			return a.Keyframes[i-1]
+		}
+		k := seconds / a.Period
+		i := int(math.Floor(k)) % n
+		if i < 0 {
+			i += n
+		}
+		f := k - math.Floor(k)
+		col = self.Space.blend(frame(i).GetInterpolatedColorFor(pos), frame((i+1)%n).GetInterpolatedColorFor(pos), f).Clamped()
+	}
+
+	if a.HueShift != 0 {
+		h, c, l := col.Hcl()
+		h = math.Mod(h+a.HueShift*seconds, 360)
+		if h < 0 {
+			h += 360
+		}
+		col = colorful.Hcl(h, c, l).Clamped()
+	}
+
+	return col
+}
@@ -0,0 +1,36 @@
+package lcv
+
+import (
+	"testing"
+)
+
+func TestAnimationInBeats(t *testing.T) {
+	gt := GradientTable{
+		Stops: []GradientStop{{Col: MustParseHex("#000000"), Pos: 0}, {Col: MustParseHex("#ffffff"), Pos: 1}},
+		Space: SpaceRGB,
+	}
+	red := GradientTable{Stops: []GradientStop{{Col: MustParseHex("#ff0000"), Pos: 0}, {Col: MustParseHex("#ff0000"), Pos: 1}}}
+
+	tests := []struct {
+		name      string
+		animation GradientAnimation
+		seconds   float64
+		beats     float64
+		want      string
+	}{
+		{"scroll in seconds", GradientAnimation{Scroll: 0.25}, 1, 3, gt.GetInterpolatedColorFor(0.5).Hex()},
+		{"scroll in beats", GradientAnimation{Scroll: 0.25, Beats: true}, 1, 2, gt.GetInterpolatedColorFor(0.75).Hex()},
+		// Each crossfade takes 2 beats, so the keyframe is reached on the
+		// second beat and faded back from on the fourth
+		{"keyframes in beats", GradientAnimation{Keyframes: []GradientTable{red}, Period: 2, Beats: true}, 0, 2, "#ff0000"},
+		{"keyframes back in beats", GradientAnimation{Keyframes: []GradientTable{red}, Period: 2, Beats: true}, 2, 4, gt.GetInterpolatedColorFor(0.25).Hex()},
+	}
+
+	for _, tt := range tests {
+		a := tt.animation
+		gt.Animation = &a
+		if got := gt.ColourAt(0.25, tt.seconds, tt.beats).Hex(); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
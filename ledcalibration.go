@@ -0,0 +1,131 @@
+package lcv
+
+import (
+	"fmt"
+	"github.com/lucasb-eyer/go-colorful"
+	"math"
+)
+
+// How the sRGB colours of the analyser are converted to the levels an output
+// drives its leds with
+type Transfer string
+
+const (
+	// Sends the sRGB values unchanged, as the outputs were driven before
+	// they could be calibrated
+	TransferNone Transfer = "none"
+	// Decodes the sRGB curve so the levels are proportional to the light
+	// wanted, for strips such as the WS2812 whose brightness is linear in
+	// the level
+	TransferSRGB Transfer = "srgb"
+	// Raises each channel to the power of the calibration's gamma
+	TransferGamma Transfer = "gamma"
+)
+
+// The colour correction applied to the colours sent to an output, so a strip
+// shows the colour the gui previews. The transfer curve is applied first,
+// then the colour matrix and then the white balance. The gui preview is not
+// calibrated
+type Calibration struct {
+	// The transfer curve, "none" if it is empty
+	Transfer Transfer `json:"transfer,omitempty"`
+	// The exponent of the gamma transfer curve, e.g. 2.2
+	Gamma float64 `json:"gamma,omitempty"`
+	// The 3x3 matrix the red, green and blue levels are multiplied by to
+	// correct for the primaries of the leds, by rows. Not applied if nil
+	Matrix *[3][3]float64 `json:"matrix,omitempty"`
+	// The gains of the red, green and blue levels, e.g. [1, 0.8, 0.7] to
+	// warm up a strip which is too blue. Not applied if nil
+	WhiteBalance *[3]float64 `json:"whiteBalance,omitempty"`
+}
+
+// Returns a description of each problem with a calibration
+func (c *Calibration) problems(prefix string) []string {
+	var problems []string
+	add := func(field, format string, args ...interface{}) {
+		problems = append(problems, prefix+field+": "+fmt.Sprintf(format, args...))
+	}
+	finite := func(v float64) bool {
+		return !math.IsNaN(v) && !math.IsInf(v, 0)
+	}
+
+	switch c.Transfer {
+	case "", TransferNone, TransferSRGB:
+	case TransferGamma:
+		if !(c.Gamma > 0 && c.Gamma <= 5) {
+			add("gamma", "must be in the range (0, 5] for the gamma transfer curve, got %g", c.Gamma)
+		}
+	default:
+		add("transfer", "must be one of none, srgb or gamma, got %q", c.Transfer)
+	}
+
+	if c.Matrix != nil {
+		for i, row := range c.Matrix {
+			for j, v := range row {
+				if !finite(v) {
+					add(fmt.Sprintf("matrix[%d][%d]", i, j), "must be a number, got %g", v)
+				}
+			}
+		}
+	}
+	if c.WhiteBalance != nil {
+		for i, v := range c.WhiteBalance {
+			if !finite(v) || v < 0 {
+				add(fmt.Sprintf("whiteBalance[%d]", i), "must not be negative, got %g", v)
+			}
+		}
+	}
+
+	return problems
+}
+
+// Returns a copy of the calibration which shares nothing with the original
+func (c *Calibration) clone() *Calibration {
+	if c == nil {
+		return nil
+	}
+	cc := *c
+	if c.Matrix != nil {
+		m := *c.Matrix
+		cc.Matrix = &m
+	}
+	if c.WhiteBalance != nil {
+		wb := *c.WhiteBalance
+		cc.WhiteBalance = &wb
+	}
+	return &cc
+}
+
+// Converts a colour to the levels of the red, green and blue leds of the
+// output, each in the range [0, 1]. A nil calibration leaves the colour
+// unchanged
+func (c *Calibration) levels(col colorful.Color) colorful.Color {
+	if c == nil {
+		return col.Clamped()
+	}
+
+	col = col.Clamped()
+	rgb := [3]float64{col.R, col.G, col.B}
+	switch c.Transfer {
+	case TransferSRGB:
+		rgb[0], rgb[1], rgb[2] = col.LinearRgb()
+	case TransferGamma:
+		for i, v := range rgb {
+			rgb[i] = math.Pow(v, c.Gamma)
+		}
+	}
+
+	if c.Matrix != nil {
+		in := rgb
+		for i, row := range c.Matrix {
+			rgb[i] = row[0]*in[0] + row[1]*in[1] + row[2]*in[2]
+		}
+	}
+	if c.WhiteBalance != nil {
+		for i := range rgb {
+			rgb[i] *= c.WhiteBalance[i]
+		}
+	}
+
+	return colorful.Color{R: rgb[0], G: rgb[1], B: rgb[2]}.Clamped()
+}
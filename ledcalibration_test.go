@@ -0,0 +1,92 @@
+package lcv
+
+import (
+	"github.com/lucasb-eyer/go-colorful"
+	"math"
+	"testing"
+)
+
+func closeColour(a, b colorful.Color) bool {
+	return math.Abs(a.R-b.R) < 1e-6 && math.Abs(a.G-b.G) < 1e-6 && math.Abs(a.B-b.B) < 1e-6
+}
+
+func TestCalibrationIdentity(t *testing.T) {
+	identity := [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	unity := [3]float64{1, 1, 1}
+	calibrations := map[string]*Calibration{
+		"nil":      nil,
+		"empty":    {},
+		"none":     {Transfer: TransferNone},
+		"gamma 1":  {Transfer: TransferGamma, Gamma: 1},
+		"identity": {Matrix: &identity, WhiteBalance: &unity},
+	}
+	colours := []colorful.Color{
+		{R: 0, G: 0, B: 0},
+		{R: 1, G: 1, B: 1},
+		{R: 0.2, G: 0.5, B: 0.8},
+		MustParseHex("#faf6cb"),
+	}
+
+	for name, c := range calibrations {
+		for _, col := range colours {
+			if got := c.levels(col); !closeColour(got, col) {
+				t.Errorf("%s: %v became %v", name, col, got)
+			}
+		}
+	}
+}
+
+func TestCalibrationLevels(t *testing.T) {
+	swap := [3][3]float64{{0, 0, 1}, {0, 1, 0}, {1, 0, 0}}
+	gains := [3]float64{1, 0.5, 0.25}
+	halve := [3]float64{0.5, 1, 1}
+
+	tests := []struct {
+		name string
+		c    *Calibration
+		in   colorful.Color
+		want colorful.Color
+	}{
+		{"gamma 2.2 half", &Calibration{Transfer: TransferGamma, Gamma: 2.2}, colorful.Color{R: 0.5, G: 0.25, B: 1}, colorful.Color{R: 0.2176376, G: 0.0473661, B: 1}},
+		{"gamma 2.2 ends", &Calibration{Transfer: TransferGamma, Gamma: 2.2}, colorful.Color{R: 0, G: 1, B: 0}, colorful.Color{R: 0, G: 1, B: 0}},
+		{"srgb", &Calibration{Transfer: TransferSRGB}, colorful.Color{R: 0.5, G: 0.04045, B: 1}, colorful.Color{R: 0.2140411, G: 0.0031308, B: 1}},
+		{"gains", &Calibration{WhiteBalance: &gains}, colorful.Color{R: 1, G: 1, B: 1}, colorful.Color{R: 1, G: 0.5, B: 0.25}},
+		{"gains on a colour", &Calibration{WhiteBalance: &gains}, colorful.Color{R: 0.4, G: 0.8, B: 0.8}, colorful.Color{R: 0.4, G: 0.4, B: 0.2}},
+		{"swapped primaries", &Calibration{Matrix: &swap}, colorful.Color{R: 1, G: 0.5, B: 0}, colorful.Color{R: 0, G: 0.5, B: 1}},
+		// The transfer curve comes first, then the matrix, then the gains
+		{"order", &Calibration{Transfer: TransferGamma, Gamma: 2, Matrix: &swap, WhiteBalance: &halve}, colorful.Color{R: 0.5, G: 0, B: 1}, colorful.Color{R: 0.5, G: 0, B: 0.25}},
+		// The levels are clamped after the gains
+		{"clamped", &Calibration{WhiteBalance: &[3]float64{2, 2, 2}}, colorful.Color{R: 0.75, G: 0.25, B: 0}, colorful.Color{R: 1, G: 0.5, B: 0}},
+	}
+
+	for _, tt := range tests {
+		if got := tt.c.levels(tt.in); !closeColour(got, tt.want) {
+			t.Errorf("%s: %v became %v, want %v", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCalibrationInEncode(t *testing.T) {
+	swap := [3][3]float64{{0, 0, 1}, {0, 1, 0}, {1, 0, 0}}
+	halve := [3]float64{0.5, 1, 1}
+	target := OutputTarget{Calibration: &Calibration{Transfer: TransferGamma, Gamma: 2, Matrix: &swap, WhiteBalance: &halve}}
+	col := colorful.Color{R: 0.5, G: 0, B: 1}
+
+	value, _, gain := target.encode(col, 1)
+	if value != 0x800040 || gain != 1 {
+		t.Errorf("got %#06x at gain %g, want 0x800040 at gain 1", value, gain)
+	}
+	// The brightness scales the calibrated levels
+	if value, _, _ := target.encode(col, 0.5); value != 0x400020 {
+		t.Errorf("at half brightness got %#06x, want 0x400020", value)
+	}
+
+	// The gui preview is the sRGB colour, the calibration only changes what
+	// is sent to the output
+	if preview := ColourUINT32(col); preview != 0x8000ff {
+		t.Errorf("the preview is %#06x, want the sRGB colour 0x8000ff", preview)
+	}
+	if col != (colorful.Color{R: 0.5, G: 0, B: 1}) {
+		t.Errorf("encoding changed the colour to %v", col)
+	}
+}
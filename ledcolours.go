@@ -1,9 +1,13 @@
 package lcv
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/lucasb-eyer/go-colorful"
 	"sort"
+	"strings"
 )
 
 // BOX COLOUR IMPLEMENTATION
@@ -11,6 +15,11 @@ import (
 // straight to uint32
 type boxColour colorful.Color
 
+// Converts a colour to a uint32 value of the form 0xRRGGBB
+func ColourUINT32(c colorful.Color) uint32 {
+	return boxColour(c).UINT32()
+}
+
 // Converts the box colour type to a uint32 value
 func (col boxColour) UINT32() uint32 {
 	var r = uint32(col.R*255.0 + 0.5)
@@ -25,30 +34,211 @@ func (col boxColour) UINT32() uint32 {
 	return r
 }
 
-// GRADIENTS
-// This table contains the "keypoints" of the colorgradient you want to generate.
-// The position of each keypoint has to live in the range [0,1]
-type GradientTable []struct {
+// A "keypoint" of a gradient, the colour the gradient has at a position.
+// The position has to live in the range [0,1]
+type GradientStop struct {
 	Col colorful.Color
 	Pos float64
+	// How the colour changes from this keypoint to the next, linear if it
+	// is empty
+	Easing Easing `json:",omitempty"`
+}
+
+// Reads a keypoint from json. The colour is either an object of its R, G
+// and B levels or a hex string such as "#ff8000"
+func (s *GradientStop) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Col    json.RawMessage
+		Pos    *float64
+		Easing Easing
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+	if raw.Col == nil {
+		return errors.New("a gradient stop has no Col")
+	}
+	if raw.Pos == nil {
+		return errors.New("a gradient stop has no Pos")
+	}
+
+	var col colorful.Color
+	if trimmed := bytes.TrimSpace(raw.Col); len(trimmed) > 0 && trimmed[0] == '"' {
+		var hex string
+		if err := json.Unmarshal(trimmed, &hex); err != nil {
+			return err
+		}
+		c, err := colorful.Hex(hex)
+		if err != nil || !isHexColour(hex) {
+			return fmt.Errorf("gradient stop colour %q is not a hex colour like #ff8000", hex)
+		}
+		col = c
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(raw.Col))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&col); err != nil {
+			return fmt.Errorf("gradient stop colour %s: %w", trimmed, err)
+		}
+	}
+
+	*s = GradientStop{Col: col, Pos: *raw.Pos, Easing: raw.Easing}
+	return nil
+}
+
+// Returns whether s is a hex colour of the form #rgb or #rrggbb, which
+// colorful.Hex does not check fully
+func isHexColour(s string) bool {
+	if (len(s) != 4 && len(s) != 7) || s[0] != '#' {
+		return false
+	}
+	for _, r := range s[1:] {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// GRADIENTS
+// This table contains the "keypoints" of the colorgradient you want to generate
+// and the colour space they are blended in.
+type GradientTable struct {
+	// The keypoints of the gradient, sorted by their position
+	Stops []GradientStop `json:"stops"`
+	// The colour space the keypoints are blended in, HCL if it is empty
+	Space ColourSpace `json:"space,omitempty"`
+	// Maps the frequency to a position in the gradient, nil uses the
+	// analyser's parameters unless the config has a curve of its own
+	Curve *FrequencyCurve `json:"curve,omitempty"`
+	// Makes the gradient change over time, nil for a gradient which stays
+	// the same
+	Animation *GradientAnimation `json:"animation,omitempty"`
 }
 
-// This is the meat of the gradient computation. It returns a HCL-blend between
-// the two colors around `t`.
-// Note: It relies heavily on the fact that the gradient keypoints are sorted.
+// Reads a gradient from json. Gradients saved before they had a colour space
+// are a plain array of keypoints and are blended in HCL. The gradient is
+// normalised, the problems which cannot be fixed are left for validation
+func (self *GradientTable) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		*self = GradientTable{}
+		if err := json.Unmarshal(trimmed, &self.Stops); err != nil {
+			return err
+		}
+		self.Normalise()
+		return nil
+	}
+
+	// The alias has no UnmarshalJSON method so it is decoded as a struct
+	type gradientTable GradientTable
+	var gt gradientTable
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&gt); err != nil {
+		return err
+	}
+	*self = GradientTable(gt)
+	self.Normalise()
+	return nil
+}
+
+// How far outside [0, 1] a keypoint's position can be and still be moved to
+// the nearest end by Normalise, further is an error
+const gradientPosTolerance = 0.01
+
+// Fixes the problems of a gradient which can be fixed without changing how
+// it looks: the keypoints are sorted by position, positions just outside
+// [0, 1] are moved into it, colour levels are clamped to [0, 1] and
+// keypoints which are repeated, with colours which cannot be told apart, or
+// hidden between two others at the same position are removed. The keyframes
+// of its animation are normalised too
+func (self *GradientTable) Normalise() {
+	stops := self.Stops
+	for i := range stops {
+		if p := stops[i].Pos; p < 0 && p >= -gradientPosTolerance {
+			stops[i].Pos = 0
+		} else if p > 1 && p <= 1+gradientPosTolerance {
+			stops[i].Pos = 1
+		}
+		stops[i].Col = stops[i].Col.Clamped()
+	}
+	sort.SliceStable(stops, func(i, j int) bool {
+		return stops[i].Pos < stops[j].Pos
+	})
+
+	kept := stops[:0]
+	for _, s := range stops {
+		if n := len(kept); n > 0 {
+			prev := kept[n-1]
+			// The easing of the last of repeated keypoints is the one
+			// which takes effect
+			if s.Pos == prev.Pos && s.Col.AlmostEqualRgb(prev.Col) {
+				kept[n-1] = s
+				continue
+			}
+			// Only the first and last keypoint at a position can be seen
+			if n > 1 && s.Pos == prev.Pos && s.Pos == kept[n-2].Pos {
+				kept[n-1] = s
+				continue
+			}
+		}
+		kept = append(kept, s)
+	}
+	self.Stops = kept
+
+	if self.Animation != nil {
+		for i := range self.Animation.Keyframes {
+			self.Animation.Keyframes[i].Normalise()
+		}
+	}
+}
+
+// Returns a normalised copy of the gradient, leaving the gradient and its
+// animation as they are
+func (self GradientTable) normalised() *GradientTable {
+	gt := self
+	gt.Stops = append([]GradientStop(nil), self.Stops...)
+	if self.Animation != nil {
+		a := *self.Animation
+		a.Keyframes = append([]GradientTable(nil), a.Keyframes...)
+		for i := range a.Keyframes {
+			a.Keyframes[i].Stops = append([]GradientStop(nil), a.Keyframes[i].Stops...)
+		}
+		gt.Animation = &a
+	}
+	gt.Normalise()
+	return &gt
+}
+
+// This is the meat of the gradient computation. It returns a blend between
+// the two colors around `t` in the gradient's colour space.
+// Note: It relies heavily on the fact that the gradient keypoints are sorted,
+// which Normalise makes sure of.
 func (self GradientTable) GetInterpolatedColorFor(t float64) colorful.Color {
-	for i := 0; i < len(self)-1; i++ {
-		c1 := self[i]
-		c2 := self[i+1]
+	if len(self.Stops) == 0 {
+		return colorful.Color{}
+	}
+	// Before the first keypoint the gradient has its colour
+	if t <= self.Stops[0].Pos {
+		return self.Stops[0].Col
+	}
+
+	for i := 0; i < len(self.Stops)-1; i++ {
+		c1 := self.Stops[i]
+		c2 := self.Stops[i+1]
 		if c1.Pos <= t && t <= c2.Pos {
+			if c1.Pos == c2.Pos {
+				return c2.Col
+			}
 			// We are in between c1 and c2. Go blend them!
-			t := (t - c1.Pos) / (c2.Pos - c1.Pos)
-			return c1.Col.BlendHcl(c2.Col, t).Clamped()
+			t := c1.Easing.apply((t - c1.Pos) / (c2.Pos - c1.Pos))
+			return self.Space.blend(c1.Col, c2.Col, t).Clamped()
 		}
 	}
 
 	// Nothing found? Means we're at (or past) the last gradient keypoint.
-	return self[len(self)-1].Col
+	return self.Stops[len(self.Stops)-1].Col
 }
 
 // This is a very nice thing Golang forces you to do!
@@ -61,69 +251,79 @@ func MustParseHex(s string) colorful.Color {
 	return c
 }
 
-// Functions which returns a gradient function based on its name
-func getGradientTable(s string) (*GradientTable, error) {
+// Returns the builtin or user gradient with the given name
+func GradientByName(s string) (*GradientTable, error) {
 	if val, ok := gradients[s]; ok {
 		return val, nil
 	}
 
-	return &GradientTable{}, errors.New("Gradient name incorrect")
+	userGradientsMu.RLock()
+	defer userGradientsMu.RUnlock()
+	if val, ok := userGradients[s]; ok {
+		return val, nil
+	}
+
+	return &GradientTable{}, fmt.Errorf("%w: %q", ErrGradientNotFound, s)
 }
 
+// Returned when a gradient name does not match any gradient
+var ErrGradientNotFound = errors.New("gradient not found")
+
 // Gradients available to users hardcoded into the application
 var gradients = map[string]*GradientTable{
-	"starboy": &GradientTable{
-		//{MustParseHex("#1a0406"), 0.0},
-		{MustParseHex("#1152cb"), 0.0},
-		{MustParseHex("#1152cb"), 0.05},
-		{MustParseHex("#e4032f"), 0.1},
-		{MustParseHex("#f6c507"), 0.55},
-		//{MustParseHex("#faf4e6"), 0.7},
-		{MustParseHex("#faf6cb"), 1.0},
-		//{MustParseHex("#faf4e6"), 1.0},
-	},
-	"franklake": &GradientTable{
-		//{MustParseHex("#007dfe"), 0},
-		{MustParseHex("#ff7303"), 0},
-		{MustParseHex("#ff7303"), 0.1},
-		{MustParseHex("#ffa7e1"), 0.5},
-		{MustParseHex("#faf4e6"), 1.0},
-	},
-	"smiths": &GradientTable{
-		{MustParseHex("#ff0202"), 0},
-		{MustParseHex("#ff0202"), 0.1},
-		{MustParseHex("#ff8d00"), 0.3},
-		{MustParseHex("#fff400"), 0.5},
-		{MustParseHex("#f1ff00"), 0.8},
-		{MustParseHex("#A4ff00"), 1.0},
-	},
-	"weeknd": &GradientTable{
-		//{MustParseHex("#ff0202"), 0.0},
-		//{MustParseHex("#ff0258"), 0.03},
-		{MustParseHex("#5202fc"), 0.00},
-		{MustParseHex("#ff0074"), 0.9},
-		//{MustParseHex("#ff0000"), 1.0},
-	},
-	"shabjdeed": &GradientTable{
-		{MustParseHex("#020024"), 0.0},
-		{MustParseHex("#ad63f4"), 0.35},
-		{MustParseHex("#00d4ff"), 1.0},
-	},
+	"starboy": &GradientTable{Stops: []GradientStop{
+		//{Col: MustParseHex("#1a0406"), Pos: 0.0},
+		{Col: MustParseHex("#1152cb"), Pos: 0.0},
+		{Col: MustParseHex("#1152cb"), Pos: 0.05},
+		{Col: MustParseHex("#e4032f"), Pos: 0.1},
+		{Col: MustParseHex("#f6c507"), Pos: 0.55},
+		//{Col: MustParseHex("#faf4e6"), Pos: 0.7},
+		{Col: MustParseHex("#faf6cb"), Pos: 1.0},
+		//{Col: MustParseHex("#faf4e6"), Pos: 1.0},
+	}},
+	"franklake": &GradientTable{Stops: []GradientStop{
+		//{Col: MustParseHex("#007dfe"), Pos: 0},
+		{Col: MustParseHex("#ff7303"), Pos: 0},
+		{Col: MustParseHex("#ff7303"), Pos: 0.1},
+		{Col: MustParseHex("#ffa7e1"), Pos: 0.5},
+		{Col: MustParseHex("#faf4e6"), Pos: 1.0},
+	}},
+	"smiths": &GradientTable{Stops: []GradientStop{
+		{Col: MustParseHex("#ff0202"), Pos: 0},
+		{Col: MustParseHex("#ff0202"), Pos: 0.1},
+		{Col: MustParseHex("#ff8d00"), Pos: 0.3},
+		{Col: MustParseHex("#fff400"), Pos: 0.5},
+		{Col: MustParseHex("#f1ff00"), Pos: 0.8},
+		{Col: MustParseHex("#A4ff00"), Pos: 1.0},
+	}},
+	"weeknd": &GradientTable{Stops: []GradientStop{
+		//{Col: MustParseHex("#ff0202"), Pos: 0.0},
+		//{Col: MustParseHex("#ff0258"), Pos: 0.03},
+		{Col: MustParseHex("#5202fc"), Pos: 0.00},
+		{Col: MustParseHex("#ff0074"), Pos: 0.9},
+		//{Col: MustParseHex("#ff0000"), Pos: 1.0},
+	}},
+	"shabjdeed": &GradientTable{Stops: []GradientStop{
+		{Col: MustParseHex("#020024"), Pos: 0.0},
+		{Col: MustParseHex("#ad63f4"), Pos: 0.35},
+		{Col: MustParseHex("#00d4ff"), Pos: 1.0},
+	}},
 }
 
-// Returns a string slice of the names of the hardcoded gradients
-func gradientList() []string {
+// Returns a string slice of the names of the hardcoded gradients and the
+// user gradients, including "default" for the hue colouring
+func GradientNames() []string {
 	keys := make([]string, 0, len(gradients))
 	for k := range gradients {
 		keys = append(keys, k)
 	}
+	userGradientsMu.RLock()
+	for k := range userGradients {
+		keys = append(keys, k)
+	}
+	userGradientsMu.RUnlock()
 	keys = append(keys, "default")
 	sort.Strings(keys)
 
 	return keys
 }
-
-// Returns the name of a gradient at a given index of the gradient list
-func getGradientName(i int) string {
-	return gradientList()[i]
-}
@@ -0,0 +1,129 @@
+package lcv
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGradientUnmarshalNormalises(t *testing.T) {
+	tests := []struct {
+		name  string
+		json  string
+		space ColourSpace
+		stops []testStop
+	}{
+		{"unsorted stops",
+			`{"stops": [{"Col": "#0000ff", "Pos": 1}, {"Col": "#ff0000", "Pos": 0}, {"Col": "#00ff00", "Pos": 0.5}]}`,
+			"", []testStop{{"#ff0000", 0, ""}, {"#00ff00", 0.5, ""}, {"#0000ff", 1, ""}}},
+		{"positions within the tolerance",
+			`{"stops": [{"Col": "#ff0000", "Pos": -0.005}, {"Col": "#0000ff", "Pos": 1.01}], "space": "rgb"}`,
+			SpaceRGB, []testStop{{"#ff0000", 0, ""}, {"#0000ff", 1, ""}}},
+		{"positions outside the tolerance are left",
+			`{"stops": [{"Col": "#ff0000", "Pos": -0.02}, {"Col": "#0000ff", "Pos": 1.5}]}`,
+			"", []testStop{{"#ff0000", -0.02, ""}, {"#0000ff", 1.5, ""}}},
+		// The last of repeated stops sets the easing, colours which differ by
+		// less than can be seen are repeats
+		{"duplicate stops",
+			`{"stops": [{"Col": "#ff0000", "Pos": 0}, {"Col": "#00ff00", "Pos": 0.5},
+				{"Col": {"R": 0, "G": 0.9999999, "B": 0}, "Pos": 0.5, "Easing": "step"}, {"Col": "#0000ff", "Pos": 1}]}`,
+			"", []testStop{{"#ff0000", 0, ""}, {"#00ff00", 0.5, EaseStep}, {"#0000ff", 1, ""}}},
+		{"different colours at a position are kept",
+			`{"stops": [{"Col": "#ff0000", "Pos": 0}, {"Col": "#00ff00", "Pos": 0.5}, {"Col": "#00ff80", "Pos": 0.5}, {"Col": "#0000ff", "Pos": 1}]}`,
+			"", []testStop{{"#ff0000", 0, ""}, {"#00ff00", 0.5, ""}, {"#00ff80", 0.5, ""}, {"#0000ff", 1, ""}}},
+		{"hidden stops",
+			`{"stops": [{"Col": "#ff0000", "Pos": 0}, {"Col": "#00ff00", "Pos": 0.5}, {"Col": "#ffffff", "Pos": 0.5},
+				{"Col": "#000000", "Pos": 0.5}, {"Col": "#00ffff", "Pos": 0.5}, {"Col": "#0000ff", "Pos": 1}]}`,
+			"", []testStop{{"#ff0000", 0, ""}, {"#00ff00", 0.5, ""}, {"#00ffff", 0.5, ""}, {"#0000ff", 1, ""}}},
+		{"colour levels are clamped",
+			`{"stops": [{"Col": {"R": 1.5, "G": -0.5, "B": 0}, "Pos": 0}, {"Col": "#0000ff", "Pos": 1}]}`,
+			"", []testStop{{"#ff0000", 0, ""}, {"#0000ff", 1, ""}}},
+		{"legacy array format",
+			`[{"Col": {"R": 1, "G": 0, "B": 0}, "Pos": 1}, {"Col": {"R": 0, "G": 0, "B": 1}, "Pos": 0}]`,
+			"", []testStop{{"#0000ff", 0, ""}, {"#ff0000", 1, ""}}},
+	}
+
+	for _, tt := range tests {
+		var gt GradientTable
+		if err := json.Unmarshal([]byte(tt.json), &gt); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		checkStops(t, tt.name, &gt, tt.space, tt.stops)
+	}
+}
+
+func TestGradientUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want string
+	}{
+		{"short hex", `{"stops": [{"Col": "#12345", "Pos": 0}, {"Col": "#0000ff", "Pos": 1}]}`, "#12345"},
+		{"bad hex digits", `{"stops": [{"Col": "#ggg", "Pos": 0}, {"Col": "#0000ff", "Pos": 1}]}`, "#ggg"},
+		{"no hash", `{"stops": [{"Col": "ff0000", "Pos": 0}, {"Col": "#0000ff", "Pos": 1}]}`, "ff0000"},
+		{"missing position", `{"stops": [{"Col": "#ff0000"}, {"Col": "#0000ff", "Pos": 1}]}`, "no Pos"},
+		{"missing colour", `{"stops": [{"Pos": 0}, {"Col": "#0000ff", "Pos": 1}]}`, "no Col"},
+		{"unknown field", `{"stops": [{"Col": "#ff0000", "Pos": 0, "Alpha": 1}, {"Col": "#0000ff", "Pos": 1}]}`, "Alpha"},
+		{"unknown colour field", `{"stops": [{"Col": {"R": 1, "A": 1}, "Pos": 0}, {"Col": "#0000ff", "Pos": 1}]}`, `"A"`},
+	}
+
+	for _, tt := range tests {
+		var gt GradientTable
+		err := json.Unmarshal([]byte(tt.json), &gt)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want one mentioning %s", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestGradientProblems(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want []string
+	}{
+		{"valid", `{"stops": [{"Col": "#ff0000", "Pos": 0}, {"Col": "#0000ff", "Pos": 1}]}`, nil},
+		{"one stop", `{"stops": [{"Col": "#ff0000", "Pos": 0}]}`, []string{"gradient: must have at least 2 colours"}},
+		{"position out of range", `{"stops": [{"Col": "#ff0000", "Pos": -0.02}, {"Col": "#0000ff", "Pos": 1}]}`,
+			[]string{"gradient[0].Pos: must be in the range [0, 1]"}},
+		{"unknown easing", `{"stops": [{"Col": "#ff0000", "Pos": 0, "Easing": "bounce"}, {"Col": "#0000ff", "Pos": 1}]}`,
+			[]string{"gradient[0].Easing: must be one of"}},
+		{"unknown space", `{"stops": [{"Col": "#ff0000", "Pos": 0}, {"Col": "#0000ff", "Pos": 1}], "space": "cmyk"}`,
+			[]string{"gradient.space: must be one of"}},
+	}
+
+	for _, tt := range tests {
+		var gt GradientTable
+		if err := json.Unmarshal([]byte(tt.json), &gt); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		problems := gradientProblems("gradient", &gt)
+		if len(problems) != len(tt.want) {
+			t.Errorf("%s: got problems %q, want %q", tt.name, problems, tt.want)
+			continue
+		}
+		for i, want := range tt.want {
+			if !strings.HasPrefix(problems[i], want) {
+				t.Errorf("%s: got problem %q, want %q", tt.name, problems[i], want)
+			}
+		}
+	}
+}
+
+func TestGradientNormalisedCopy(t *testing.T) {
+	kf := GradientTable{Stops: []GradientStop{{Col: MustParseHex("#ffffff"), Pos: 1}, {Col: MustParseHex("#000000"), Pos: 0}}}
+	gt := &GradientTable{
+		Stops:     []GradientStop{{Col: MustParseHex("#0000ff"), Pos: 1}, {Col: MustParseHex("#ff0000"), Pos: 0}},
+		Animation: &GradientAnimation{Keyframes: []GradientTable{kf}, Period: 1},
+	}
+
+	n := gt.normalised()
+	checkStops(t, "copy", n, "", []testStop{{"#ff0000", 0, ""}, {"#0000ff", 1, ""}})
+	checkStops(t, "copy keyframe", &n.Animation.Keyframes[0], "", []testStop{{"#000000", 0, ""}, {"#ffffff", 1, ""}})
+
+	// The original is left unsorted
+	checkStops(t, "original", gt, "", []testStop{{"#0000ff", 1, ""}, {"#ff0000", 0, ""}})
+	checkStops(t, "original keyframe", &gt.Animation.Keyframes[0], "", []testStop{{"#ffffff", 1, ""}, {"#000000", 0, ""}})
+}
@@ -0,0 +1,130 @@
+package lcv
+
+import (
+	"fmt"
+	"github.com/lucasb-eyer/go-colorful"
+	"math"
+	"strings"
+)
+
+// The colour space the colours of a gradient are blended in. Blending the
+// same two colours in different spaces gives different intermediate colours,
+// e.g. blue to red passes through a dull purple in RGB and a bright magenta
+// in HCL
+type ColourSpace string
+
+const (
+	// Blends the gamma encoded red, green and blue values
+	SpaceRGB ColourSpace = "rgb"
+	// Blends the red, green and blue light intensities
+	SpaceLinearRGB ColourSpace = "linearrgb"
+	// Blends the hue, saturation and value, taking the shortest way around
+	// the hue circle
+	SpaceHSV ColourSpace = "hsv"
+	// Blends the hue, chroma and luminance of CIE LCh, the space gradients
+	// used before they could choose one
+	SpaceHCL ColourSpace = "hcl"
+	// Blends in CIE L*a*b*
+	SpaceLab ColourSpace = "lab"
+	// Blends in CIE L*u*v*
+	SpaceLuv ColourSpace = "luv"
+	// Blends in Oklab, which keeps the lightness and hue of the intermediate
+	// colours even
+	SpaceOKLab ColourSpace = "oklab"
+)
+
+// The space a gradient with no space set is blended in
+const defaultColourSpace = SpaceHCL
+
+// The colour spaces a gradient can be blended in
+var colourSpaces = []ColourSpace{SpaceRGB, SpaceLinearRGB, SpaceHSV, SpaceHCL, SpaceLab, SpaceLuv, SpaceOKLab}
+
+// Returns the colour spaces a gradient can be blended in
+func ColourSpaces() []ColourSpace {
+	return append([]ColourSpace(nil), colourSpaces...)
+}
+
+// Parses the name of a colour space, ignoring case. An empty name is the
+// default space
+func ParseColourSpace(s string) (ColourSpace, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return defaultColourSpace, nil
+	}
+	for _, space := range colourSpaces {
+		if s == string(space) {
+			return space, nil
+		}
+	}
+	return "", fmt.Errorf("unknown colour space %q, expected one of %s", s, joinColourSpaces())
+}
+
+// Returns the names of the colour spaces separated by commas
+func joinColourSpaces() string {
+	names := make([]string, len(colourSpaces))
+	for i, space := range colourSpaces {
+		names[i] = string(space)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Reports whether the space is one of the colour spaces or empty
+func (space ColourSpace) valid() bool {
+	_, err := ParseColourSpace(string(space))
+	return err == nil
+}
+
+// Returns the colour a fraction t of the way from c1 to c2 blended in the
+// space, the result may be outside the RGB gamut
+func (space ColourSpace) blend(c1, c2 colorful.Color, t float64) colorful.Color {
+	switch space {
+	case SpaceRGB:
+		return c1.BlendRgb(c2, t)
+	case SpaceLinearRGB:
+		r1, g1, b1 := c1.LinearRgb()
+		r2, g2, b2 := c2.LinearRgb()
+		return colorful.LinearRgb(r1+t*(r2-r1), g1+t*(g2-g1), b1+t*(b2-b1))
+	case SpaceHSV:
+		return c1.BlendHsv(c2, t)
+	case SpaceLab:
+		return c1.BlendLab(c2, t)
+	case SpaceLuv:
+		return c1.BlendLuv(c2, t)
+	case SpaceOKLab:
+		l1, a1, b1 := oklab(c1)
+		l2, a2, b2 := oklab(c2)
+		return fromOklab(l1+t*(l2-l1), a1+t*(a2-a1), b1+t*(b2-b1))
+	default:
+		return c1.BlendHcl(c2, t)
+	}
+}
+
+// Converts a colour to Oklab, see https://bottosson.github.io/posts/oklab/
+// go-colorful does not support Oklab in the version used
+func oklab(c colorful.Color) (l, a, b float64) {
+	r, g, bl := c.LinearRgb()
+
+	lc := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*bl)
+	mc := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*bl)
+	sc := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*bl)
+
+	l = 0.2104542553*lc + 0.7936177850*mc - 0.0040720468*sc
+	a = 1.9779984951*lc - 2.4285922050*mc + 0.4505937099*sc
+	b = 0.0259040371*lc + 0.7827717662*mc - 0.8086757660*sc
+	return l, a, b
+}
+
+// Converts an Oklab colour back to RGB
+func fromOklab(l, a, b float64) colorful.Color {
+	lc := l + 0.3963377774*a + 0.2158037573*b
+	mc := l - 0.1055613458*a - 0.0638541728*b
+	sc := l - 0.0894841775*a - 1.2914855480*b
+
+	lc, mc, sc = lc*lc*lc, mc*mc*mc, sc*sc*sc
+
+	return colorful.LinearRgb(
+		4.0767416621*lc-3.3077115913*mc+0.2309699292*sc,
+		-1.2684380046*lc+2.6097574011*mc-0.3413193965*sc,
+		-0.0041960863*lc-0.7034186147*mc+1.7076147010*sc,
+	)
+}
@@ -0,0 +1,101 @@
+package lcv
+
+import (
+	"github.com/lucasb-eyer/go-colorful"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Reports whether two colours are the same to within the precision of the
+// conversions between colour spaces
+func nearColour(a, b colorful.Color) bool {
+	return math.Abs(a.R-b.R) < 1e-5 && math.Abs(a.G-b.G) < 1e-5 && math.Abs(a.B-b.B) < 1e-5
+}
+
+func TestOklab(t *testing.T) {
+	// Reference values from https://bottosson.github.io/posts/oklab/
+	tests := []struct {
+		c       colorful.Color
+		l, a, b float64
+	}{
+		{colorful.Color{R: 1, G: 1, B: 1}, 1, 0, 0},
+		{colorful.Color{}, 0, 0, 0},
+		{colorful.Color{R: 1}, 0.627955, 0.224863, 0.125846},
+		{colorful.Color{G: 1}, 0.866440, -0.233888, 0.179498},
+		{colorful.Color{B: 1}, 0.452014, -0.032457, -0.311528},
+	}
+	for _, tt := range tests {
+		l, a, b := oklab(tt.c)
+		if math.Abs(l-tt.l) > 1e-4 || math.Abs(a-tt.a) > 1e-4 || math.Abs(b-tt.b) > 1e-4 {
+			t.Errorf("%v is (%g, %g, %g) in Oklab, want (%g, %g, %g)", tt.c, l, a, b, tt.l, tt.a, tt.b)
+		}
+	}
+
+	// Colours survive the round trip
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		c := colorful.Color{R: r.Float64(), G: r.Float64(), B: r.Float64()}
+		if back := fromOklab(oklab(c)); !nearColour(back, c) {
+			t.Fatalf("%v became %v after a round trip through Oklab", c, back)
+		}
+	}
+}
+
+func TestBlend(t *testing.T) {
+	blue, red := MustParseHex("#0000ff"), MustParseHex("#ff0000")
+	for _, space := range append(ColourSpaces(), "") {
+		// The ends of the blend are the colours
+		if got := space.blend(blue, red, 0); !nearColour(got, blue) {
+			t.Errorf("%q: blend at 0 is %v, want %v", space, got, blue)
+		}
+		if got := space.blend(blue, red, 1); !nearColour(got, red) {
+			t.Errorf("%q: blend at 1 is %v, want %v", space, got, red)
+		}
+		// The same colour blends to itself
+		grey := MustParseHex("#808080")
+		if got := space.blend(grey, grey, 0.5); !nearColour(got, grey) {
+			t.Errorf("%q: grey blended with itself is %v", space, got)
+		}
+	}
+
+	// The middle of blue and red in each space
+	tests := []struct {
+		space ColourSpace
+		want  colorful.Color
+	}{
+		{SpaceRGB, colorful.Color{R: 0.5, B: 0.5}},
+		{SpaceLinearRGB, colorful.LinearRgb(0.5, 0, 0.5)},
+		{SpaceHSV, colorful.Hsv(300, 1, 1)},
+		{SpaceLab, blue.BlendLab(red, 0.5)},
+		{SpaceLuv, blue.BlendLuv(red, 0.5)},
+		{SpaceHCL, blue.BlendHcl(red, 0.5)},
+		{"", blue.BlendHcl(red, 0.5)},
+		{SpaceOKLab, fromOklab(0.5399845, 0.096203, -0.092841)},
+	}
+	for _, tt := range tests {
+		if got := tt.space.blend(blue, red, 0.5); !nearColour(got, tt.want) {
+			t.Errorf("%q: blend at 0.5 is %v, want %v", tt.space, got, tt.want)
+		}
+	}
+
+	// The hue takes the shortest way around the circle, so the middle of
+	// two reds either side of 0° is red rather than cyan
+	for _, space := range []ColourSpace{SpaceHSV, SpaceHCL} {
+		var c1, c2 colorful.Color
+		if space == SpaceHSV {
+			c1, c2 = colorful.Hsv(340, 1, 1), colorful.Hsv(20, 1, 1)
+		} else {
+			c1, c2 = colorful.Hcl(340, 0.5, 0.5), colorful.Hcl(20, 0.5, 0.5)
+		}
+		var h float64
+		if mid := space.blend(c1, c2, 0.5); space == SpaceHSV {
+			h, _, _ = mid.Hsv()
+		} else {
+			h, _, _ = mid.Hcl()
+		}
+		if dist := math.Min(h, 360-h); dist > 1e-3 {
+			t.Errorf("%q: the middle of 340° and 20° has hue %g, want 0", space, h)
+		}
+	}
+}
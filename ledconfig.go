@@ -0,0 +1,322 @@
+package lcv
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Every setting of an analyser, as stored in a json config file
+type Config struct {
+	// The colour mapping and the parameters which shape the audio stream
+	Params Params `json:"params"`
+	// The smoothing, damping and input filter settings
+	Filter FilterParams `json:"filter"`
+	// The name of the gradient used to colour the audio, "default" for the
+	// hue colouring
+	Gradient string `json:"gradient"`
+	// A custom gradient used instead of the named gradient
+	CustomGradient *GradientTable `json:"customGradient,omitempty"`
+	// Maps the frequency to a position in the gradient or to a hue, in place
+	// of the gradient's curve and the parameters. Not used if it is nil
+	Curve *FrequencyCurve `json:"curve,omitempty"`
+	// The start of the name of the input device, empty for the default device
+	InputDevice string `json:"inputDevice"`
+	// Whether a spectrogram is created when the analyser stops
+	Spectrogram bool `json:"spectrogram"`
+	// The destinations the colours are sent to
+	Outputs []OutputTarget `json:"outputs"`
+}
+
+// Returns the config an analyser uses when no options are given
+func DefaultConfig() Config {
+	return Config{
+		Params:      DefaultParams(),
+		Filter:      DefaultFilterParams(),
+		Gradient:    "default",
+		InputDevice: "Line 1",
+		Outputs: []OutputTarget{
+			{Name: "led lights", Address: defaultOutputAddress, Enabled: false},
+		},
+	}
+}
+
+// Reads a config from a json file. Settings missing from the file keep
+// their default values, unknown settings and invalid values are errors
+func LoadConfig(path string) (Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	c := DefaultConfig()
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&c); err != nil {
+		return Config{}, fmt.Errorf("%s: %v", path, describeJSONError(data, err))
+	}
+	if err := c.Validate(); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// Writes the config to a json file. The file is replaced in one step so an
+// interrupted save never leaves a partly written config
+func (c Config) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(path, append(data, '\n'))
+}
+
+// Writes a file through a uniquely named temporary file which is renamed
+// over it, so the file is never seen half written even when it is saved from
+// two places at once
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Checks every setting of the config, the error lists each invalid setting
+// by its name in the config file
+func (c Config) Validate() error {
+	problems := c.Params.problems("params.")
+	problems = append(problems, c.Filter.problems("filter.", c.Params.SampleRate)...)
+
+	if c.CustomGradient != nil {
+		problems = append(problems, gradientProblems("customGradient", c.CustomGradient.normalised())...)
+	} else if c.Gradient != "" && c.Gradient != "default" {
+		if _, err := GradientByName(c.Gradient); err != nil {
+			problems = append(problems, fmt.Sprintf("gradient: no gradient named %q", c.Gradient))
+		}
+	}
+
+	if c.Curve != nil {
+		problems = append(problems, curveProblems("curve", c.Curve)...)
+	}
+
+	names := make(map[string]bool)
+	for i, t := range c.Outputs {
+		field := fmt.Sprintf("outputs[%d]", i)
+		if t.Name == "" {
+			problems = append(problems, field+".name: must not be empty")
+		} else if names[t.Name] {
+			problems = append(problems, fmt.Sprintf("%s.name: %q is used by another output", field, t.Name))
+		}
+		names[t.Name] = true
+		if _, err := net.ResolveUDPAddr("udp4", t.Address); err != nil {
+			problems = append(problems, fmt.Sprintf("%s.address: %v", field, err))
+		}
+		if t.Calibration != nil {
+			problems = append(problems, t.Calibration.problems(field+".calibration.")...)
+		}
+		if t.White != nil {
+			problems = append(problems, t.White.problems(field+".white.")...)
+		}
+		if t.Power != nil {
+			problems = append(problems, t.Power.problems(field+".power.")...)
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// The narrowest frequency bins in Hz the analysis accepts, the rate after
+// decimation divided by the buffer length. Narrower bins put every detected
+// frequency in the first few bins
+const minBinSize = 1
+
+// Returns a description of each invalid parameter, prefixed with the name
+// of the parameters in the config
+func (p Params) problems(prefix string) []string {
+	var problems []string
+	add := func(field, format string, args ...interface{}) {
+		problems = append(problems, prefix+field+": "+fmt.Sprintf(format, args...))
+	}
+
+	if p.FCap <= 0 {
+		add("fCap", "must be positive, got %g", p.FCap)
+	}
+	if p.UsefulCap <= 0 || p.UsefulCap > p.FCap {
+		add("usefulCap", "must be positive and at most fCap (%g), got %g", p.FCap, p.UsefulCap)
+	}
+	if p.TotalHue <= 0 || p.TotalHue > 360 {
+		add("totalHue", "must be in the range (0, 360], got %g", p.TotalHue)
+	}
+	if p.FCapHue < 0 || p.FCapHue > p.TotalHue {
+		add("fCapHue", "must be in the range [0, totalHue (%g)], got %g", p.TotalHue, p.FCapHue)
+	}
+	if p.BufferLength < 2 || p.BufferLength&(p.BufferLength-1) != 0 {
+		add("bufferLength", "must be a power of 2, got %d", p.BufferLength)
+	}
+	if p.SampleRate < 0 {
+		add("sampleRate", "must not be negative, got %g", p.SampleRate)
+	}
+	if p.Decimation < 1 || (p.BufferLength > 0 && p.BufferLength%p.Decimation != 0) {
+		add("decimation", "must be at least 1 and divide bufferLength (%d), got %d", p.BufferLength, p.Decimation)
+	} else if p.SampleRate > 0 && p.BufferLength > 0 {
+		// The rate of the device is only known once its stream is opened,
+		// so without a sampleRate the bins are checked then
+		if bin := p.SampleRate / float64(p.Decimation) / float64(p.BufferLength); bin < minBinSize {
+			add("decimation", "leaves frequency bins of %.3g Hz at sampleRate %g and bufferLength %d, they must be at least %g Hz", bin, p.SampleRate, p.BufferLength, float64(minBinSize))
+		}
+	}
+	if p.SpectrogramFrames < 1 {
+		add("spectrogramFrames", "must be at least 1, got %d", p.SpectrogramFrames)
+	}
+	if p.Brightness <= 0 || p.Brightness > 1 {
+		add("brightness", "must be in the range (0, 1], got %g", p.Brightness)
+	}
+
+	return problems
+}
+
+// Returns a description of each invalid filter setting, the input filters
+// must lie below the Nyquist frequency of every sample rate given. Rates of
+// 0 are unknown and not checked
+func (f FilterParams) problems(prefix string, sampleRates ...float64) []string {
+	var problems []string
+	add := func(field, format string, args ...interface{}) {
+		problems = append(problems, prefix+field+": "+fmt.Sprintf(format, args...))
+	}
+
+	if f.SmoothAlpha < 0 || f.SmoothAlpha > 1 {
+		add("smoothAlpha", "must be in the range [0, 1], got %g", f.SmoothAlpha)
+	}
+	if f.DampLength < 1 {
+		add("dampLength", "must be at least 1, got %d", f.DampLength)
+	}
+	if f.HighPassF < 0 {
+		add("highPassF", "must not be negative, got %g", f.HighPassF)
+	}
+	if f.HumF < 0 {
+		add("humF", "must not be negative, got %g", f.HumF)
+	}
+	if f.BandLowF < 0 {
+		add("bandLowF", "must not be negative, got %g", f.BandLowF)
+	}
+	if f.BandHighF < 0 {
+		add("bandHighF", "must not be negative, got %g", f.BandHighF)
+	} else if f.BandLowF > 0 && f.BandHighF > 0 && f.BandHighF <= f.BandLowF {
+		add("bandHighF", "must be above bandLowF %g, got %g", f.BandLowF, f.BandHighF)
+	}
+
+	// The lowest rate is the one the filters have to fit
+	rate := 0.0
+	for _, r := range sampleRates {
+		if r > 0 && (rate == 0 || r < rate) {
+			rate = r
+		}
+	}
+	if rate > 0 && f.HighPassF >= rate/2 {
+		add("highPassF", "must be below half the %g Hz sample rate, got %g", rate, f.HighPassF)
+	}
+	if rate > 0 && f.BandLowF >= rate/2 {
+		add("bandLowF", "must be below half the %g Hz sample rate, got %g", rate, f.BandLowF)
+	}
+	if rate > 0 && f.BandHighF >= rate/2 {
+		add("bandHighF", "must be below half the %g Hz sample rate, got %g", rate, f.BandHighF)
+	}
+	// The notches are placed on the first three harmonics of the hum
+	if rate > 0 && 3*f.HumF >= rate/2 {
+		add("humF", "must be below a sixth of the %g Hz sample rate, got %g", rate, f.HumF)
+	}
+
+	return problems
+}
+
+// Returns a description of each problem with a gradient table which
+// Normalise cannot fix, the table must already be normalised
+func gradientProblems(field string, gt *GradientTable) []string {
+	var problems []string
+	if len(gt.Stops) < 2 {
+		problems = append(problems, fmt.Sprintf("%s: must have at least 2 colours, got %d", field, len(gt.Stops)))
+	}
+	for i, c := range gt.Stops {
+		if !(c.Pos >= 0 && c.Pos <= 1) {
+			problems = append(problems, fmt.Sprintf("%s[%d].Pos: must be in the range [0, 1], got %g", field, i, c.Pos))
+		}
+		problems = append(problems, easingProblems(fmt.Sprintf("%s[%d]", field, i), c.Easing)...)
+	}
+	if !gt.Space.valid() {
+		problems = append(problems, fmt.Sprintf("%s.space: must be one of %s, got %q", field, joinColourSpaces(), gt.Space))
+	}
+	if gt.Curve != nil {
+		problems = append(problems, curveProblems(field+".curve", gt.Curve)...)
+	}
+	if gt.Animation != nil {
+		problems = append(problems, animationProblems(field+".animation", gt.Animation)...)
+	}
+	return problems
+}
+
+// Adds the line and column of a syntax or type error to its message
+func describeJSONError(data []byte, err error) error {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		if typeErr.Field != "" {
+			err = fmt.Errorf("%s: cannot use a json %s as %s", typeErr.Field, typeErr.Value, typeErr.Type)
+		}
+		offset = typeErr.Offset
+	default:
+		return err
+	}
+
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	line := 1 + bytes.Count(data[:offset], []byte("\n"))
+	col := int(offset) - bytes.LastIndexByte(data[:offset], '\n')
+	return fmt.Errorf("line %d, column %d: %v", line, col, err)
+}
+
+// Returns the current settings of the analyser as a config, with the
+// parameters which shape the audio stream reported as Snapshot does
+func (aa *AudioAnalyser) Config() Config {
+	snap := aa.Snapshot()
+
+	c := Config{
+		Params:      snap.Params,
+		Filter:      snap.Filter,
+		Gradient:    snap.GradientName,
+		InputDevice: snap.InputDevice,
+		Spectrogram: snap.Spectrogram,
+		Outputs:     snap.Outputs,
+		Curve:       snap.Curve,
+	}
+	if c.Gradient == "" {
+		c.Gradient = "default"
+		c.CustomGradient = snap.Gradient
+	}
+	return c
+}
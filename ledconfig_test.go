@@ -0,0 +1,73 @@
+package lcv
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParamsRejectNarrowBins(t *testing.T) {
+	tests := []struct {
+		sampleRate float64
+		decimation int
+		ok         bool
+	}{
+		{44100, 1, true},
+		{44100, 4, true},
+		{44100, 16, true},
+		// 44100/32/2048 is 0.67 Hz
+		{44100, 32, false},
+		// The rate of the device is checked when the stream opens
+		{0, 32, true},
+	}
+
+	for _, tt := range tests {
+		p := DefaultConfig().Params
+		p.SampleRate = tt.sampleRate
+		p.BufferLength = 2048
+		p.Decimation = tt.decimation
+
+		problems := p.problems("params.")
+		if ok := len(problems) == 0; ok != tt.ok {
+			t.Errorf("sampleRate %g decimation %d: got problems %q, want ok %v", tt.sampleRate, tt.decimation, problems, tt.ok)
+		}
+		for _, problem := range problems {
+			if !strings.HasPrefix(problem, "params.decimation:") {
+				t.Errorf("sampleRate %g decimation %d: unexpected problem %q", tt.sampleRate, tt.decimation, problem)
+			}
+		}
+	}
+}
+
+func TestFilterParamsNyquist(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  FilterParams
+		rates   []float64
+		invalid []string
+	}{
+		{"unknown rate", FilterParams{DampLength: 1, HighPassF: 30000}, []float64{0}, nil},
+		{"below nyquist", FilterParams{DampLength: 1, HighPassF: 30, HumF: 50}, []float64{44100}, nil},
+		{"high-pass at nyquist", FilterParams{DampLength: 1, HighPassF: 22050}, []float64{44100}, []string{"filter.highPassF"}},
+		{"lowest rate", FilterParams{DampLength: 1, HighPassF: 10000}, []float64{48000, 16000, 0}, []string{"filter.highPassF"}},
+		{"hum harmonics", FilterParams{DampLength: 1, HumF: 3000}, []float64{16000}, []string{"filter.humF"}},
+		{"negative", FilterParams{DampLength: 0, HighPassF: -1}, nil, []string{"filter.dampLength", "filter.highPassF"}},
+		{"band", FilterParams{DampLength: 1, BandLowF: 200, BandHighF: 2000}, []float64{44100}, nil},
+		{"open band", FilterParams{DampLength: 1, BandHighF: 2000}, []float64{44100}, nil},
+		{"band at nyquist", FilterParams{DampLength: 1, BandLowF: 8000}, []float64{16000}, []string{"filter.bandLowF"}},
+		{"empty band", FilterParams{DampLength: 1, BandLowF: 2000, BandHighF: 200}, nil, []string{"filter.bandHighF"}},
+		{"negative band", FilterParams{DampLength: 1, BandLowF: -1, BandHighF: -1}, nil, []string{"filter.bandLowF", "filter.bandHighF"}},
+	}
+
+	for _, tt := range tests {
+		problems := tt.filter.problems("filter.", tt.rates...)
+		if len(problems) != len(tt.invalid) {
+			t.Errorf("%s: got problems %q, want problems with %q", tt.name, problems, tt.invalid)
+			continue
+		}
+		for i, field := range tt.invalid {
+			if !strings.HasPrefix(problems[i], field+":") {
+				t.Errorf("%s: got problem %q, want one with %s", tt.name, problems[i], field)
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package lcv
+
+import (
+	"fmt"
+	"math"
+)
+
+// How a frequency curve is interpolated between its points
+type CurveInterpolation string
+
+const (
+	// Straight lines between the points
+	CurveLinear CurveInterpolation = "linear"
+	// Straight lines on a log frequency axis, so each octave between two
+	// points covers the same range of positions
+	CurveLog CurveInterpolation = "log"
+	// A smooth curve through the points which never overshoots them, so the
+	// positions only rise where the points rise
+	CurveSpline CurveInterpolation = "spline"
+)
+
+// A point of a frequency curve, the frequency in Hz is mapped to the position
+// in the gradient in the range [0, 1]
+type CurvePoint struct {
+	Frequency float64 `json:"frequency"`
+	Position  float64 `json:"position"`
+}
+
+// Maps the detected frequency to a position in the gradient, replacing the
+// mapping set by fCap, usefulCap, fCapHue and totalHue. Frequencies below the
+// first point or above the last take the position of that point
+type FrequencyCurve struct {
+	// The points of the curve sorted by frequency
+	Points []CurvePoint `json:"points"`
+	// How the curve is interpolated between the points, linear if it is
+	// empty
+	Interpolation CurveInterpolation `json:"interpolation,omitempty"`
+}
+
+// Returns a description of each problem with a frequency curve
+func curveProblems(field string, c *FrequencyCurve) []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, field+fmt.Sprintf(format, args...))
+	}
+
+	switch c.Interpolation {
+	case "", CurveLinear, CurveLog, CurveSpline:
+	default:
+		add(".interpolation: must be linear, log or spline, got %q", c.Interpolation)
+	}
+	if len(c.Points) < 2 {
+		add(".points: must have at least 2 points, got %d", len(c.Points))
+	}
+	for i, p := range c.Points {
+		if p.Frequency < 0 || (c.Interpolation == CurveLog && p.Frequency == 0) {
+			add(".points[%d].frequency: must be positive, got %g", i, p.Frequency)
+		}
+		if i > 0 && p.Frequency <= c.Points[i-1].Frequency {
+			add(".points[%d].frequency: must be above the previous point's", i)
+		}
+		if p.Position < 0 || p.Position > 1 {
+			add(".points[%d].position: must be in the range [0, 1], got %g", i, p.Position)
+		}
+	}
+
+	return problems
+}
+
+// Returns the position in the gradient of a frequency
+func (c *FrequencyCurve) position(f float64) float64 {
+	pts := c.Points
+	if f <= pts[0].Frequency {
+		return pts[0].Position
+	}
+	last := len(pts) - 1
+	if f >= pts[last].Frequency {
+		return pts[last].Position
+	}
+
+	// The segment the frequency is in
+	i := 0
+	for pts[i+1].Frequency < f {
+		i++
+	}
+	p0, p1 := pts[i], pts[i+1]
+
+	switch c.Interpolation {
+	case CurveLog:
+		t := math.Log(f/p0.Frequency) / math.Log(p1.Frequency/p0.Frequency)
+		return p0.Position + t*(p1.Position-p0.Position)
+	case CurveSpline:
+		return c.spline(i, f)
+	default:
+		t := (f - p0.Frequency) / (p1.Frequency - p0.Frequency)
+		return p0.Position + t*(p1.Position-p0.Position)
+	}
+}
+
+// Evaluates the monotone cubic Hermite spline through the points at f, which
+// lies between point i and i+1. The tangents are found with the method of
+// Fritsch and Carlson so the curve does not overshoot
+func (c *FrequencyCurve) spline(i int, f float64) float64 {
+	pts := c.Points
+	slope := func(k int) float64 {
+		return (pts[k+1].Position - pts[k].Position) / (pts[k+1].Frequency - pts[k].Frequency)
+	}
+	tangent := func(k int) float64 {
+		switch {
+		case k == 0:
+			return slope(0)
+		case k == len(pts)-1:
+			return slope(k - 1)
+		}
+		s0, s1 := slope(k-1), slope(k)
+		if s0*s1 <= 0 {
+			return 0
+		}
+		// Harmonic mean weighted by the lengths of the segments
+		h0 := pts[k].Frequency - pts[k-1].Frequency
+		h1 := pts[k+1].Frequency - pts[k].Frequency
+		return 3 * (h0 + h1) / ((2*h1+h0)/s0 + (h1+2*h0)/s1)
+	}
+
+	p0, p1 := pts[i], pts[i+1]
+	h := p1.Frequency - p0.Frequency
+	m0, m1 := tangent(i)*h, tangent(i+1)*h
+	t := (f - p0.Frequency) / h
+	t2, t3 := t*t, t*t*t
+
+	pos := (2*t3-3*t2+1)*p0.Position + (t3-2*t2+t)*m0 + (-2*t3+3*t2)*p1.Position + (t3-t2)*m1
+	return math.Max(0, math.Min(1, pos))
+}
@@ -0,0 +1,122 @@
+package lcv
+
+import (
+	"math"
+	"testing"
+)
+
+var testCurvePoints = []CurvePoint{
+	{Frequency: 40, Position: 0},
+	{Frequency: 100, Position: 0.1},
+	{Frequency: 200, Position: 0.5},
+	// A flat segment, the curve must not rise or dip within it
+	{Frequency: 400, Position: 0.5},
+	{Frequency: 800, Position: 0.55},
+	{Frequency: 2500, Position: 1},
+	{Frequency: 5000, Position: 1},
+}
+
+var testCurveInterpolations = []CurveInterpolation{"", CurveLinear, CurveLog, CurveSpline}
+
+func TestCurveKnots(t *testing.T) {
+	for _, interp := range testCurveInterpolations {
+		c := &FrequencyCurve{Points: testCurvePoints, Interpolation: interp}
+		for _, p := range c.Points {
+			if got := c.position(p.Frequency); math.Abs(got-p.Position) > 1e-9 {
+				t.Errorf("%q: %g Hz is at %g, want the point's %g", interp, p.Frequency, got, p.Position)
+			}
+		}
+
+		// Outside the points the position is that of the nearest point
+		for _, f := range []float64{0, 20, 39.9} {
+			if got := c.position(f); got != 0 {
+				t.Errorf("%q: %g Hz below the first point is at %g, want 0", interp, f, got)
+			}
+		}
+		for _, f := range []float64{5000.1, 20000, math.Inf(1)} {
+			if got := c.position(f); got != 1 {
+				t.Errorf("%q: %g Hz above the last point is at %g, want 1", interp, f, got)
+			}
+		}
+	}
+}
+
+func TestCurveMonotone(t *testing.T) {
+	for _, interp := range testCurveInterpolations {
+		c := &FrequencyCurve{Points: testCurvePoints, Interpolation: interp}
+		prev := c.position(20)
+		for f := 20.0; f <= 6000; f += 0.5 {
+			got := c.position(f)
+			if got < prev-1e-12 || got < 0 || got > 1 {
+				t.Fatalf("%q: %g Hz is at %g after %g", interp, f, got, prev)
+			}
+			prev = got
+		}
+
+		// Flat segments stay flat
+		for f := 200.0; f <= 400; f++ {
+			if got := c.position(f); math.Abs(got-0.5) > 1e-9 {
+				t.Fatalf("%q: %g Hz in the flat segment is at %g, want 0.5", interp, f, got)
+			}
+		}
+		for f := 2500.0; f <= 5000; f += 10 {
+			if got := c.position(f); math.Abs(got-1) > 1e-9 {
+				t.Fatalf("%q: %g Hz in the flat end is at %g, want 1", interp, f, got)
+			}
+		}
+	}
+}
+
+func TestCurveInterpolations(t *testing.T) {
+	// An empty interpolation is linear
+	pts := []CurvePoint{{Frequency: 100, Position: 0}, {Frequency: 400, Position: 1}}
+	linear := &FrequencyCurve{Points: pts, Interpolation: CurveLinear}
+	empty := &FrequencyCurve{Points: pts}
+	for f := 100.0; f <= 400; f += 7 {
+		if a, b := empty.position(f), linear.position(f); a != b {
+			t.Errorf("%g Hz is at %g with no interpolation, want the linear %g", f, a, b)
+		}
+	}
+
+	// Linear is halfway at the middle frequency, log at the middle octave
+	if got := linear.position(250); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("linear 250 Hz is at %g, want 0.5", got)
+	}
+	log := &FrequencyCurve{Points: pts, Interpolation: CurveLog}
+	if got := log.position(200); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("log 200 Hz is at %g, want 0.5", got)
+	}
+
+	// The spline through points on a line is the line
+	line := []CurvePoint{{100, 0}, {200, 0.2}, {500, 0.8}, {600, 1}}
+	spline := &FrequencyCurve{Points: line, Interpolation: CurveSpline}
+	straight := &FrequencyCurve{Points: line, Interpolation: CurveLinear}
+	for f := 100.0; f <= 600; f += 3 {
+		if a, b := spline.position(f), straight.position(f); math.Abs(a-b) > 1e-9 {
+			t.Errorf("spline %g Hz is at %g, want the line's %g", f, a, b)
+		}
+	}
+}
+
+func TestCurveProblems(t *testing.T) {
+	tests := []struct {
+		name string
+		c    FrequencyCurve
+		ok   bool
+	}{
+		{"valid", FrequencyCurve{Points: testCurvePoints, Interpolation: CurveSpline}, true},
+		{"one point", FrequencyCurve{Points: testCurvePoints[:1]}, false},
+		{"unknown interpolation", FrequencyCurve{Points: testCurvePoints, Interpolation: "cubic"}, false},
+		{"unsorted", FrequencyCurve{Points: []CurvePoint{{200, 0}, {100, 1}}}, false},
+		{"repeated frequency", FrequencyCurve{Points: []CurvePoint{{100, 0}, {100, 1}}}, false},
+		{"position out of range", FrequencyCurve{Points: []CurvePoint{{100, 0}, {200, 1.5}}}, false},
+		{"zero on a log axis", FrequencyCurve{Points: []CurvePoint{{0, 0}, {200, 1}}, Interpolation: CurveLog}, false},
+		{"zero on a linear axis", FrequencyCurve{Points: []CurvePoint{{0, 0}, {200, 1}}}, true},
+	}
+
+	for _, tt := range tests {
+		if problems := curveProblems("curve", &tt.c); (len(problems) == 0) != tt.ok {
+			t.Errorf("%s: got problems %q, want ok %v", tt.name, problems, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package lcv
+
+import (
+	"fmt"
+	"strings"
+)
+
+// How the colour of a gradient changes from a stop to the next stop
+type Easing string
+
+const (
+	// At an even rate, the easing of a stop which has none
+	EaseLinear Easing = "linear"
+	// Slowly away from the stop and quickly into the next
+	EaseIn Easing = "ease-in"
+	// Quickly away from the stop and slowly into the next
+	EaseOut Easing = "ease-out"
+	// Slowly at both stops and quickly between them
+	EaseInOut Easing = "ease-in-out"
+	// Holding the colour of the stop up to the next stop
+	EaseStep Easing = "step"
+)
+
+// Returns the easings in the order they are offered
+func Easings() []Easing {
+	return []Easing{EaseLinear, EaseIn, EaseOut, EaseInOut, EaseStep}
+}
+
+// Returns whether the easing is known, an empty easing is linear
+func (e Easing) valid() bool {
+	if e == "" {
+		return true
+	}
+	for _, known := range Easings() {
+		if e == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the easings as a list for error messages
+func joinEasings() string {
+	names := make([]string, len(Easings()))
+	for i, e := range Easings() {
+		names[i] = string(e)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Returns a description of the problem with the easing of a stop, if any
+func easingProblems(field string, e Easing) []string {
+	if e.valid() {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s.Easing: must be one of %s, got %q", field, joinEasings(), e)}
+}
+
+// Maps the fraction of the way t from a stop to the next to the fraction of
+// the way between their colours
+func (e Easing) apply(t float64) float64 {
+	switch e {
+	case EaseIn:
+		return t * t
+	case EaseOut:
+		return 1 - (1-t)*(1-t)
+	case EaseInOut:
+		return t * t * (3 - 2*t)
+	case EaseStep:
+		if t >= 1 {
+			return 1
+		}
+		return 0
+	default:
+		return t
+	}
+}
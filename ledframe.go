@@ -0,0 +1,71 @@
+package lcv
+
+import (
+	"math"
+	"math/cmplx"
+	"time"
+)
+
+// The results of analysing one chunk of audio
+type Frame struct {
+	// The time the chunk was analysed
+	Time time.Time
+	// The frequency used to colour the chunk, after smoothing and damping
+	Frequency int
+	// The magnitude spectrum of the chunk, the i-th bin is at i*BinSize Hz
+	Spectrum []float32
+	// The difference in frequency between each bin of the spectrum in Hz
+	BinSize float64
+	// The rms level of the chunk in dB relative to full scale, -inf for
+	// silence
+	Loudness float64
+	// The colour of the chunk in the form 0xRRGGBB
+	Colour uint32
+	// The estimated tempo in beats per minute and the position within the
+	// current beat, see Tempo
+	BPM       float64
+	BeatPhase float64
+}
+
+// Builds the frame for an analysed chunk and delivers it to the callback and
+// the channel. The channel is never blocked on, frames are dropped if the
+// receiver is not keeping up
+func (aa *AudioAnalyser) publish(chunk []float32, colour uint32) {
+	if aa.cb == nil && aa.frames == nil {
+		return
+	}
+
+	spectrum := make([]float32, int(aa.u.bufferLengthUseful))
+	for i := range spectrum {
+		spectrum[i] = float32(cmplx.Abs(complex128(aa.u.bfft[i])))
+	}
+
+	var sum float64
+	for _, v := range chunk {
+		sum += float64(v) * float64(v)
+	}
+	loudness := 10 * math.Log10(sum/float64(len(chunk)))
+
+	bpm, phase := aa.u.tempo.tempo()
+	f := Frame{
+		Time:      time.Now(),
+		Frequency: *aa.u.f,
+		Spectrum:  spectrum,
+		BinSize:   aa.u.fBinSize,
+		Loudness:  loudness,
+		Colour:    colour,
+		BPM:       bpm,
+		BeatPhase: phase,
+	}
+
+	if aa.cb != nil {
+		aa.cb(f)
+	}
+	if aa.frames != nil {
+		select {
+		case aa.frames <- f:
+		default:
+			aa.metrics.droppedFrame()
+		}
+	}
+}
@@ -3,14 +3,13 @@ package lcv
 import (
 	"github.com/cpmech/gosl/utl"
 	"github.com/wcharczuk/go-chart"
-	"log"
 	"os"
 	"time"
 )
 
 // Renders a graph given the names of each series, the elapsed time of
 // streaming and each frequency series
-func createGraph(seriesnames []string, elapsed_t time.Duration, freqseries ...*[]int) {
+func createGraph(seriesnames []string, elapsed_t time.Duration, freqseries ...*[]int) error {
 
 	// Create the series object which will be plotted on the graph
 	individualSeries := make([]chart.Series, len(freqseries))
@@ -53,11 +52,14 @@ func createGraph(seriesnames []string, elapsed_t time.Duration, freqseries ...*[
 	}
 
 	// Render the graph to an output file
-	f, _ := os.Create("output.png")
+	f, err := os.Create("output.png")
+	if err != nil {
+		return err
+	}
 	defer f.Close()
-	err := graph.Render(chart.PNG, f)
-	chk(err)
-
-	log.Printf("Graph rendered to file successfully")
+	if err := graph.Render(chart.PNG, f); err != nil {
+		return err
+	}
 
+	return nil
 }
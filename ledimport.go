@@ -0,0 +1,545 @@
+package lcv
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/lucasb-eyer/go-colorful"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Returned when a gradient file has an extension no importer reads
+var ErrUnknownGradientFormat = errors.New("unknown gradient format")
+
+// Reads a gradient from a file, choosing the format by its extension: json
+// gradients saved by the gradient creator, CSS linear-gradient() strings
+// (.css), GIMP gradients (.ggr) and cpt-city/GMT palettes (.cpt). The
+// gradient is checked before it is returned
+func ImportGradient(path string) (*GradientTable, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case ".json":
+		return readGradientFile(path)
+	case ".css", ".ggr", ".cpt":
+	default:
+		return nil, fmt.Errorf("%w %q, expected .json, .css, .ggr or .cpt", ErrUnknownGradientFormat, ext)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var gt *GradientTable
+	switch ext {
+	case ".css":
+		var data []byte
+		if data, err = ioutil.ReadAll(f); err == nil {
+			gt, err = ParseCSSGradient(string(data))
+		}
+	case ".ggr":
+		gt, err = ParseGGR(f)
+	case ".cpt":
+		gt, err = ParseCPT(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+
+	if problems := gradientProblems("gradient", gt); len(problems) > 0 {
+		return nil, fmt.Errorf("%s: %s", filepath.Base(path), strings.Join(problems, "; "))
+	}
+	return gt, nil
+}
+
+// Returns the name a gradient imported from a file is given, the name of
+// the file without its extension
+func ImportedGradientName(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// Scales the positions of the stops so the first is at 0 and the last at 1
+func normaliseStops(stops []GradientStop) {
+	first, last := stops[0].Pos, stops[len(stops)-1].Pos
+	if first == 0 && last == 1 {
+		return
+	}
+	for i := range stops {
+		if last > first {
+			stops[i].Pos = (stops[i].Pos - first) / (last - first)
+		} else {
+			stops[i].Pos = float64(i) / float64(len(stops)-1)
+		}
+	}
+}
+
+// CSS
+
+// Colours CSS names which are accepted in gradients, the basic colours and a
+// few common ones
+var cssColourNames = map[string]string{
+	"black": "#000000", "silver": "#c0c0c0", "gray": "#808080", "grey": "#808080",
+	"white": "#ffffff", "maroon": "#800000", "red": "#ff0000", "purple": "#800080",
+	"fuchsia": "#ff00ff", "magenta": "#ff00ff", "green": "#008000", "lime": "#00ff00",
+	"olive": "#808000", "yellow": "#ffff00", "navy": "#000080", "blue": "#0000ff",
+	"teal": "#008080", "aqua": "#00ffff", "cyan": "#00ffff", "orange": "#ffa500",
+	"pink": "#ffc0cb", "gold": "#ffd700", "indigo": "#4b0082", "violet": "#ee82ee",
+	"brown": "#a52a2a", "transparent": "#000000",
+}
+
+// Parses a CSS linear-gradient(), e.g.
+//
+//	linear-gradient(90deg, #1152cb 5%, rgb(228, 3, 47) 10%, gold)
+//
+// The first linear-gradient() in s is read, so it may be part of a CSS rule.
+// The direction and colour hints are ignored, transparency is dropped and
+// positions must be percentages. Stops without a position are spread out as
+// CSS does, and positions outside 0% to 100% are scaled into it
+func ParseCSSGradient(s string) (*GradientTable, error) {
+	i := strings.Index(s, "linear-gradient(")
+	if i == -1 {
+		return nil, errors.New("no linear-gradient() found")
+	}
+	s = s[i+len("linear-gradient("):]
+
+	// The arguments run to the matching parenthesis, anything after it is
+	// the rest of the CSS
+	depth, end := 1, -1
+	for j, r := range s {
+		if r == '(' {
+			depth++
+		} else if r == ')' {
+			if depth--; depth == 0 {
+				end = j
+				break
+			}
+		}
+	}
+	if end == -1 {
+		return nil, errors.New("linear-gradient( is not closed")
+	}
+	args := splitCSSArgs(s[:end])
+
+	// The first argument may be the direction
+	if len(args) > 0 {
+		first := strings.ToLower(args[0])
+		if strings.HasPrefix(first, "to ") || strings.HasSuffix(first, "deg") || strings.HasSuffix(first, "turn") || strings.HasSuffix(first, "rad") {
+			args = args[1:]
+		}
+	}
+
+	// Each stop has a colour and up to two positions, NaN marks a position
+	// which is missing
+	var stops []GradientStop
+	for _, arg := range args {
+		colour, rest := splitCSSColour(arg)
+		if _, err := parseCSSPercentage(colour); err == nil && rest == "" {
+			// A colour hint, the blend is kept even
+			continue
+		}
+		col, err := parseCSSColour(colour)
+		if err != nil {
+			return nil, err
+		}
+
+		positions := strings.Fields(rest)
+		if len(positions) > 2 {
+			return nil, fmt.Errorf("colour stop %q has more than two positions", arg)
+		}
+		if len(positions) == 0 {
+			stops = append(stops, GradientStop{Col: col, Pos: math.NaN()})
+		}
+		for _, p := range positions {
+			pos, err := parseCSSPercentage(p)
+			if err != nil {
+				return nil, err
+			}
+			stops = append(stops, GradientStop{Col: col, Pos: pos})
+		}
+	}
+	if len(stops) < 2 {
+		return nil, fmt.Errorf("linear-gradient() needs at least 2 colours, got %d", len(stops))
+	}
+
+	// The ends default to 0% and 100%, a position before an earlier one is
+	// moved up to it and missing positions are spread between their
+	// neighbours
+	if math.IsNaN(stops[0].Pos) {
+		stops[0].Pos = 0
+	}
+	if last := len(stops) - 1; math.IsNaN(stops[last].Pos) {
+		stops[last].Pos = math.Max(1, stops[0].Pos)
+	}
+	max := stops[0].Pos
+	for i := range stops {
+		if !math.IsNaN(stops[i].Pos) {
+			max = math.Max(max, stops[i].Pos)
+			stops[i].Pos = max
+		}
+	}
+	for i := 1; i < len(stops); i++ {
+		if !math.IsNaN(stops[i].Pos) {
+			continue
+		}
+		j := i
+		for math.IsNaN(stops[j].Pos) {
+			j++
+		}
+		start, end := stops[i-1].Pos, stops[j].Pos
+		for k := i; k < j; k++ {
+			stops[k].Pos = start + (end-start)*float64(k-i+1)/float64(j-i+1)
+		}
+	}
+
+	// Positions outside the box are scaled into it, otherwise the end
+	// colours are held to the ends as CSS does
+	if stops[0].Pos < 0 || stops[len(stops)-1].Pos > 1 {
+		normaliseStops(stops)
+	}
+	if first := stops[0]; first.Pos > 0 {
+		stops = append([]GradientStop{{Col: first.Col, Pos: 0}}, stops...)
+	}
+	if last := stops[len(stops)-1]; last.Pos < 1 {
+		stops = append(stops, GradientStop{Col: last.Col, Pos: 1})
+	}
+	gt := &GradientTable{Stops: stops, Space: SpaceRGB}
+	gt.Normalise()
+	return gt, nil
+}
+
+// Splits the arguments of a CSS function at the commas which are not inside
+// parentheses
+func splitCSSArgs(s string) []string {
+	var args []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(args, strings.TrimSpace(s[start:]))
+}
+
+// Splits a colour stop into its colour and the positions after it
+func splitCSSColour(stop string) (colour, rest string) {
+	if i := strings.Index(stop, "("); i != -1 {
+		if j := strings.Index(stop, ")"); j > i {
+			return strings.TrimSpace(stop[:j+1]), strings.TrimSpace(stop[j+1:])
+		}
+	}
+	fields := strings.Fields(stop)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	return fields[0], strings.Join(fields[1:], " ")
+}
+
+// Parses a CSS percentage as a fraction, "0" is allowed without a unit
+func parseCSSPercentage(s string) (float64, error) {
+	if s == "0" {
+		return 0, nil
+	}
+	if !strings.HasSuffix(s, "%") {
+		return 0, fmt.Errorf("position %q must be a percentage", s)
+	}
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("position %q is not a number", s)
+	}
+	return v / 100, nil
+}
+
+// Parses a CSS colour: a hex colour, rgb(), rgba(), hsl(), hsla() or one of
+// cssColourNames
+func parseCSSColour(s string) (colorful.Color, error) {
+	lower := strings.ToLower(s)
+	if hex, ok := cssColourNames[lower]; ok {
+		lower = hex
+	}
+
+	if strings.HasPrefix(lower, "#") {
+		hex := lower[1:]
+		switch len(hex) {
+		case 4:
+			hex = hex[:3]
+		case 8:
+			hex = hex[:6]
+		}
+		c, err := colorful.Hex("#" + hex)
+		if err != nil || !isHexColour("#"+hex) {
+			return colorful.Color{}, fmt.Errorf("colour %q is not a hex colour", s)
+		}
+		return c, nil
+	}
+
+	open := strings.Index(lower, "(")
+	if open == -1 || !strings.HasSuffix(lower, ")") {
+		return colorful.Color{}, fmt.Errorf("unknown colour %q", s)
+	}
+	fn := lower[:open]
+	// The alpha after a slash or a fourth value is dropped
+	body := lower[open+1 : len(lower)-1]
+	if i := strings.Index(body, "/"); i != -1 {
+		body = body[:i]
+	}
+	values := strings.Fields(strings.Replace(body, ",", " ", -1))
+	if len(values) < 3 {
+		return colorful.Color{}, fmt.Errorf("colour %q needs 3 values", s)
+	}
+
+	// Each value is a number or a percentage of full
+	value := func(v string, full float64) (float64, error) {
+		if strings.HasSuffix(v, "%") {
+			f, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+			return f / 100 * full, err
+		}
+		return strconv.ParseFloat(strings.TrimSuffix(v, "deg"), 64)
+	}
+	var nums [3]float64
+	for i := range nums {
+		full := 255.0
+		if fn == "hsl" || fn == "hsla" {
+			full = 1
+		}
+		n, err := value(values[i], full)
+		if err != nil {
+			return colorful.Color{}, fmt.Errorf("colour %q has an invalid value %q", s, values[i])
+		}
+		nums[i] = n
+	}
+
+	switch fn {
+	case "rgb", "rgba":
+		return colorful.Color{R: nums[0] / 255, G: nums[1] / 255, B: nums[2] / 255}.Clamped(), nil
+	case "hsl", "hsla":
+		h := math.Mod(nums[0], 360)
+		if h < 0 {
+			h += 360
+		}
+		return colorful.Hsl(h, nums[1], nums[2]).Clamped(), nil
+	default:
+		return colorful.Color{}, fmt.Errorf("unknown colour function %q", fn)
+	}
+}
+
+// GIMP
+
+// The easings closest to the blending functions of GIMP gradient segments,
+// by their number. Linear and curved segments are linear
+var ggrEasings = map[int]Easing{
+	2: EaseInOut,
+	3: EaseOut,
+	4: EaseIn,
+	5: EaseStep,
+}
+
+// Parses a GIMP gradient (.ggr). Each segment gives a stop at its ends and
+// one at its midpoint if the midpoint of a linear or curved segment has been
+// moved. Other blending functions are matched by the easing of the segment,
+// and the gradient is blended in RGB or HSV as the segments are
+func ParseGGR(r io.Reader) (*GradientTable, error) {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	next := func() (string, bool) {
+		for scanner.Scan() {
+			line++
+			if text := strings.TrimSpace(scanner.Text()); text != "" {
+				return text, true
+			}
+		}
+		return "", false
+	}
+
+	header, ok := next()
+	if !ok || header != "GIMP Gradient" {
+		return nil, errors.New(`not a GIMP gradient, the first line must be "GIMP Gradient"`)
+	}
+	text, ok := next()
+	if ok && strings.HasPrefix(text, "Name:") {
+		text, ok = next()
+	}
+	count, err := strconv.Atoi(text)
+	if !ok || err != nil || count < 1 {
+		return nil, fmt.Errorf("line %d: expected the number of segments, got %q", line, text)
+	}
+
+	var stops []GradientStop
+	hsv := true
+	for i := 0; i < count; i++ {
+		text, ok := next()
+		if !ok {
+			return nil, fmt.Errorf("expected %d segments, got %d", count, i)
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 11 {
+			return nil, fmt.Errorf("line %d: a segment needs at least 11 values, got %d", line, len(fields))
+		}
+		var v [13]float64
+		for j := 0; j < len(fields) && j < len(v); j++ {
+			if v[j], err = strconv.ParseFloat(fields[j], 64); err != nil {
+				return nil, fmt.Errorf("line %d: %q is not a number", line, fields[j])
+			}
+		}
+
+		left, middle, right := v[0], v[1], v[2]
+		if !(left <= middle && middle <= right) {
+			return nil, fmt.Errorf("line %d: the segment's midpoint %g is not between its ends %g and %g", line, middle, left, right)
+		}
+		lc := colorful.Color{R: v[3], G: v[4], B: v[5]}
+		rc := colorful.Color{R: v[7], G: v[8], B: v[9]}
+		if v[12] == 0 {
+			hsv = false
+		}
+
+		// The moved midpoint of a linear or curved segment becomes a stop,
+		// the other blending functions become the easing of the left stop
+		easing, ok := ggrEasings[int(v[11])]
+		if !ok {
+			easing = EaseLinear
+		}
+		stops = append(stops, GradientStop{Col: lc, Pos: left, Easing: easing})
+		if easing == EaseLinear && math.Abs(middle-(left+right)/2) > 1e-3 {
+			mid := lc.BlendRgb(rc, 0.5)
+			if v[12] != 0 {
+				mid = lc.BlendHsv(rc, 0.5).Clamped()
+			}
+			stops = append(stops, GradientStop{Col: mid, Pos: middle})
+		}
+		stops = append(stops, GradientStop{Col: rc, Pos: right})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if stops[len(stops)-1].Pos <= stops[0].Pos {
+		return nil, errors.New("the segments have no width")
+	}
+
+	space := SpaceRGB
+	if hsv {
+		space = SpaceHSV
+	}
+	normaliseStops(stops)
+	gt := &GradientTable{Stops: stops, Space: space}
+	gt.Normalise()
+	return gt, nil
+}
+
+// cpt-city
+
+// Parses a cpt-city or GMT colour palette (.cpt). Each slice "z0 colour0 z1
+// colour1" gives a stop at both ends, with the colours as "r g b", "r/g/b",
+// "h-s-v" or a single grey level. The z values are scaled to run from 0 to 1
+// and the background, foreground and NaN colours are ignored
+func ParseCPT(r io.Reader) (*GradientTable, error) {
+	scanner := bufio.NewScanner(r)
+	hsv := false
+	var stops []GradientStop
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(text, "#") {
+			if model := strings.ToUpper(strings.Replace(text[1:], " ", "", -1)); strings.HasPrefix(model, "COLOR_MODEL=") {
+				hsv = strings.Contains(model, "HSV")
+			}
+			continue
+		}
+		if i := strings.Index(text, ";"); i != -1 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 || fields[0] == "B" || fields[0] == "F" || fields[0] == "N" {
+			continue
+		}
+		// An annotation letter may follow the slice
+		if last := fields[len(fields)-1]; last == "L" || last == "U" || last == "B" {
+			fields = fields[:len(fields)-1]
+		}
+
+		var colours [2][]string
+		switch len(fields) {
+		case 8:
+			colours = [2][]string{fields[1:4], fields[5:8]}
+			fields = []string{fields[0], fields[4]}
+		case 4:
+			colours = [2][]string{cptColourFields(fields[1]), cptColourFields(fields[3])}
+			fields = []string{fields[0], fields[2]}
+		default:
+			return nil, fmt.Errorf("line %d: expected \"z0 colour z1 colour\", got %d values", line, len(fields))
+		}
+
+		for i, z := range fields {
+			pos, err := strconv.ParseFloat(z, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %q is not a number", line, z)
+			}
+			col, err := parseCPTColour(colours[i], hsv)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			stops = append(stops, GradientStop{Col: col, Pos: pos})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(stops) < 2 {
+		return nil, errors.New("the palette has no colour slices")
+	}
+
+	space := SpaceRGB
+	if hsv {
+		space = SpaceHSV
+	}
+	normaliseStops(stops)
+	gt := &GradientTable{Stops: stops, Space: space}
+	gt.Normalise()
+	return gt, nil
+}
+
+// Splits a colour written as one field, "r/g/b", "h-s-v" or a grey level
+func cptColourFields(s string) []string {
+	switch {
+	case strings.Contains(s, "/"):
+		return strings.Split(s, "/")
+	case strings.Count(s, "-") == 2 && !strings.HasPrefix(s, "-"):
+		return strings.Split(s, "-")
+	default:
+		return []string{s, s, s}
+	}
+}
+
+// Parses the three values of a colour, 0 to 255 for RGB or hue in degrees
+// and saturation and value from 0 to 1 for HSV
+func parseCPTColour(fields []string, hsv bool) (colorful.Color, error) {
+	if len(fields) != 3 {
+		return colorful.Color{}, fmt.Errorf("colour %q needs 3 values", strings.Join(fields, "/"))
+	}
+	var v [3]float64
+	for i, f := range fields {
+		var err error
+		if v[i], err = strconv.ParseFloat(f, 64); err != nil {
+			return colorful.Color{}, fmt.Errorf("colour value %q is not a number", f)
+		}
+	}
+
+	if hsv {
+		return colorful.Hsv(v[0], v[1], v[2]).Clamped(), nil
+	}
+	return colorful.Color{R: v[0] / 255, G: v[1] / 255, B: v[2] / 255}.Clamped(), nil
+}
@@ -0,0 +1,216 @@
+package lcv
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A stop as it is compared in the tests
+type testStop struct {
+	hex    string
+	pos    float64
+	easing Easing
+}
+
+func checkStops(t *testing.T, name string, gt *GradientTable, space ColourSpace, want []testStop) {
+	t.Helper()
+	if gt.Space != space {
+		t.Errorf("%s: got space %q, want %q", name, gt.Space, space)
+	}
+	if len(gt.Stops) != len(want) {
+		t.Fatalf("%s: got %d stops %v, want %d", name, len(gt.Stops), gt.Stops, len(want))
+	}
+	for i, w := range want {
+		s := gt.Stops[i]
+		if s.Col.Hex() != w.hex || math.Abs(s.Pos-w.pos) > 1e-9 || s.Easing != w.easing {
+			t.Errorf("%s: stop %d is {%s %g %q}, want {%s %g %q}", name, i, s.Col.Hex(), s.Pos, s.Easing, w.hex, w.pos, w.easing)
+		}
+	}
+}
+
+func TestImportGradientFiles(t *testing.T) {
+	tests := []struct {
+		file  string
+		space ColourSpace
+		stops []testStop
+	}{
+		// The moved midpoint of the second segment is a stop and the third
+		// segment is curved at both ends
+		{"blues.ggr", SpaceRGB, []testStop{
+			{"#000066", 0, EaseLinear},
+			{"#3366cc", 0.5, EaseLinear},
+			{"#6699e6", 0.6, ""},
+			{"#99ccff", 0.8, EaseInOut},
+			{"#ffffff", 1, ""},
+		}},
+		{"rainbow.ggr", SpaceHSV, []testStop{
+			{"#ff0000", 0, EaseLinear},
+			{"#00ff00", 0.5, EaseLinear},
+			{"#0000ff", 1, ""},
+		}},
+		// The z values run from -1000 to 1000, and the B, F and N colours
+		// are left out
+		{"elevation.cpt", SpaceRGB, []testStop{
+			{"#0000ff", 0, ""},
+			{"#00ffff", 0.5, ""},
+			{"#ffff00", 1, ""},
+		}},
+		{"hues.cpt", SpaceHSV, []testStop{
+			{"#ff0000", 0, ""},
+			{"#00ff00", 0.5, ""},
+			{"#0000ff", 1, ""},
+		}},
+		// The first colour is held from 0% to its position
+		{"sunset.css", SpaceRGB, []testStop{
+			{"#1152cb", 0, ""},
+			{"#1152cb", 0.05, ""},
+			{"#e4032f", 0.1, ""},
+			{"#ffd700", 1, ""},
+		}},
+	}
+
+	for _, tt := range tests {
+		gt, err := ImportGradient(filepath.Join("testdata", "gradients", tt.file))
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		checkStops(t, tt.file, gt, tt.space, tt.stops)
+	}
+}
+
+func TestImportGradientUnknownFormat(t *testing.T) {
+	_, err := ImportGradient(filepath.Join("testdata", "gradients", "sunset.svg"))
+	if !errors.Is(err, ErrUnknownGradientFormat) {
+		t.Errorf("got error %v, want ErrUnknownGradientFormat", err)
+	}
+}
+
+func TestParseCSSGradient(t *testing.T) {
+	tests := []struct {
+		css   string
+		stops []testStop
+	}{
+		{"linear-gradient(red, blue)", []testStop{
+			{"#ff0000", 0, ""},
+			{"#0000ff", 1, ""},
+		}},
+		// Missing positions are spread out and hints are ignored
+		{"linear-gradient(to right, #000 0%, 30%, rgb(255, 0, 0), lime, #fff 100%)", []testStop{
+			{"#000000", 0, ""},
+			{"#ff0000", 1.0 / 3, ""},
+			{"#00ff00", 2.0 / 3, ""},
+			{"#ffffff", 1, ""},
+		}},
+		// Two positions give a band of solid colour
+		{"linear-gradient(0.25turn, red 0% 50%, blue 50% 100%)", []testStop{
+			{"#ff0000", 0, ""},
+			{"#ff0000", 0.5, ""},
+			{"#0000ff", 0.5, ""},
+			{"#0000ff", 1, ""},
+		}},
+		// Positions outside the box are scaled into it
+		{"linear-gradient(red -50%, blue 150%)", []testStop{
+			{"#ff0000", 0, ""},
+			{"#0000ff", 1, ""},
+		}},
+	}
+
+	for _, tt := range tests {
+		gt, err := ParseCSSGradient(tt.css)
+		if err != nil {
+			t.Errorf("%s: %v", tt.css, err)
+			continue
+		}
+		checkStops(t, tt.css, gt, SpaceRGB, tt.stops)
+	}
+}
+
+func TestParseCSSGradientMalformed(t *testing.T) {
+	for _, css := range []string{
+		"",
+		"radial-gradient(red, blue)",
+		"linear-gradient(red, blue",
+		"linear-gradient(red)",
+		"linear-gradient(notacolour, blue)",
+		"linear-gradient(#12345, blue)",
+		"linear-gradient(red 10px, blue)",
+		"linear-gradient(red 10% 20% 30%, blue)",
+	} {
+		if gt, err := ParseCSSGradient(css); err == nil {
+			t.Errorf("%q: got %v, want an error", css, gt.Stops)
+		}
+	}
+}
+
+func TestParseGGRMalformed(t *testing.T) {
+	segment := "0 0.5 1 0 0 0 1 1 1 1 1 0 0"
+	for name, ggr := range map[string]string{
+		"empty":         "",
+		"header":        "GIMP Palette\n1\n" + segment,
+		"no count":      "GIMP Gradient\nName: x\n",
+		"bad count":     "GIMP Gradient\nName: x\n0\n",
+		"missing":       "GIMP Gradient\nName: x\n2\n" + segment,
+		"short segment": "GIMP Gradient\n1\n0 0.5 1 0 0 0 1",
+		"not a number":  "GIMP Gradient\n1\n0 0.5 1 0 0 zero 1 1 1 1 1 0 0",
+		"midpoint":      "GIMP Gradient\n1\n0.6 0.5 1 0 0 0 1 1 1 1 1 0 0",
+		"no width":      "GIMP Gradient\n1\n0.5 0.5 0.5 0 0 0 1 1 1 1 1 0 0",
+	} {
+		if gt, err := ParseGGR(strings.NewReader(ggr)); err == nil {
+			t.Errorf("%s: got %v, want an error", name, gt.Stops)
+		}
+	}
+}
+
+func TestParseCPTMalformed(t *testing.T) {
+	for name, cpt := range map[string]string{
+		"empty":         "",
+		"only comments": "# COLOR_MODEL = RGB\nB 0 0 0\nF 255 255 255\n",
+		"fields":        "0 0 0 0 1 255 255",
+		"not a number":  "0 0 0 0 one 255 255 255",
+		"colour":        "0 0/0 1 255/255/255",
+	} {
+		if gt, err := ParseCPT(strings.NewReader(cpt)); err == nil {
+			t.Errorf("%s: got %v, want an error", name, gt.Stops)
+		}
+	}
+}
+
+func TestAddGradientRefusesToOverwrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gradients")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	gt, err := ImportGradient(filepath.Join("testdata", "gradients", "elevation.cpt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AddGradient(dir, "elevation", gt); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := ParseCSSGradient("linear-gradient(red, blue)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AddGradient(dir, "elevation", other); err == nil {
+		t.Error("adding a gradient under a saved name replaced it")
+	}
+
+	saved, err := readGradientFile(filepath.Join(dir, "elevation.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStops(t, "elevation.json", saved, SpaceRGB, []testStop{
+		{"#0000ff", 0, ""},
+		{"#00ffff", 0.5, ""},
+		{"#ffff00", 1, ""},
+	})
+}
@@ -0,0 +1,78 @@
+package lcv
+
+import (
+	"github.com/nadav-rahimi/led-colour-visualiser/dspsingle"
+	"math"
+)
+
+// Converts the audio read from the stream to the sample rate the analyser
+// works at and splits it into the chunks which are analysed. Normalising the
+// sample rate means the same music gives the same colours from any source
+type analysisInput struct {
+	// Converts the stream to the internal sample rate, nil if the stream
+	// is already at that rate
+	resampler *dspsingle.Resampler
+	// Lowers the internal sample rate further to improve the frequency
+	// resolution of the bass, nil if no decimation is used
+	decimator *dspsingle.Decimator
+	// Samples waiting to be analysed, a chunk is the first length samples
+	pending []float32
+	// The number of samples in each chunk
+	length int
+	// The number of new samples between the start of consecutive chunks
+	hop int
+	// The sample rate of the chunks
+	rate float64
+}
+
+// Generates the input stage for a stream at streamRate. The chunks are
+// resampled to internalRate, or left at the stream rate if it is 0, and then
+// decimated by the decimation factor. Decimated chunks overlap so they are
+// produced as often as undecimated chunks of the same length would be
+func newAnalysisInput(streamRate, internalRate float64, decimation, length int) *analysisInput {
+	in := &analysisInput{
+		length: length,
+		hop:    length,
+		rate:   streamRate,
+	}
+
+	if internalRate > 0 && math.Round(internalRate) != math.Round(streamRate) {
+		in.resampler = dspsingle.NewResampler(int(math.Round(streamRate)), int(math.Round(internalRate)))
+		in.rate = internalRate
+	}
+	if decimation > 1 {
+		in.decimator = dspsingle.NewDecimator(decimation)
+		in.rate /= float64(decimation)
+		in.hop = length / decimation
+	}
+
+	return in
+}
+
+// Returns the number of chunks produced per second
+func (in *analysisInput) frameRate() float64 {
+	return in.rate / float64(in.hop)
+}
+
+// Adds a block of samples read from the stream and calls f with every chunk
+// which is ready to be analysed. The chunk is only valid during the call
+func (in *analysisInput) push(block []float32, f func([]float32)) {
+	if in.resampler == nil && in.decimator == nil && len(in.pending) == 0 && len(block) == in.length {
+		// Nothing to convert, the block is the chunk
+		f(block)
+		return
+	}
+
+	if in.resampler != nil {
+		block = in.resampler.Process(block)
+	}
+	if in.decimator != nil {
+		block = in.decimator.Process(block)
+	}
+	in.pending = append(in.pending, block...)
+
+	for len(in.pending) >= in.length {
+		f(in.pending[:in.length])
+		in.pending = append(in.pending[:0], in.pending[in.hop:]...)
+	}
+}
@@ -0,0 +1,197 @@
+package lcv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// Lock guarding the user gradients, which can be reloaded while the
+	// analyser is running
+	userGradientsMu sync.RWMutex
+	// Gradients loaded from the user's gradient directory, by name
+	userGradients = map[string]*GradientTable{}
+)
+
+// Returns the directory user gradients are loaded from unless another is
+// chosen
+func DefaultGradientDir() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gradients"), nil
+}
+
+// Reads a gradient table from a json file and checks it can be used
+func readGradientFile(path string) (*GradientTable, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var gt *GradientTable
+	if err := json.Unmarshal(data, &gt); err != nil {
+		return nil, describeJSONError(data, err)
+	}
+	if gt == nil {
+		return nil, errors.New("the file does not contain a gradient")
+	}
+	if problems := gradientProblems("gradient", gt); len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "; "))
+	}
+
+	return gt, nil
+}
+
+// Loads every <name>.json gradient in dir as a user gradient named after
+// its file, replacing the user gradients loaded before. An invalid file
+// keeps the version of its gradient which was loaded before, so a gradient
+// being edited stays usable, and the errors of every invalid file are
+// returned together. A missing directory has no gradients
+func LoadGradientDir(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// The lock is held until the new gradients replace the old, so a reload
+	// running at the same time cannot undo them with gradients it kept from
+	// before
+	userGradientsMu.Lock()
+	defer userGradientsMu.Unlock()
+	old := userGradients
+
+	loaded := make(map[string]*GradientTable)
+	var problems []string
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		name := strings.TrimSuffix(f.Name(), ".json")
+		if _, ok := gradients[name]; ok || name == "default" {
+			problems = append(problems, fmt.Sprintf("%s: %q is the name of a built in gradient", f.Name(), name))
+			continue
+		}
+
+		gt, err := readGradientFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", f.Name(), err))
+			if prev, ok := old[name]; ok {
+				loaded[name] = prev
+			}
+			continue
+		}
+		loaded[name] = gt
+	}
+
+	userGradients = loaded
+
+	if len(problems) > 0 {
+		return errors.New("invalid gradients: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Returns the names of the user gradients, sorted
+func UserGradientNames() []string {
+	userGradientsMu.RLock()
+	defer userGradientsMu.RUnlock()
+
+	names := make([]string, 0, len(userGradients))
+	for name := range userGradients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Checks a name can be given to a user gradient
+func checkGradientName(name string) error {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("%q cannot be used as a gradient name", name)
+	}
+	if _, ok := gradients[name]; ok || name == "default" {
+		return fmt.Errorf("%q is the name of a built in gradient", name)
+	}
+	return nil
+}
+
+// Saves a gradient to dir as <name>.json so it is loaded as a user gradient,
+// replacing a saved gradient of the same name. The gradient is normalised
+// before it is checked and saved. The gradients in dir are not reloaded
+func SaveGradient(dir, name string, gt *GradientTable) error {
+	if err := checkGradientName(name); err != nil {
+		return err
+	}
+	gt = gt.normalised()
+	if problems := gradientProblems("gradient", gt); len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+
+	data, err := json.MarshalIndent(gt, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return WriteFileAtomic(filepath.Join(dir, name+".json"), append(data, '\n'))
+}
+
+// Saves a gradient to dir as <name>.json like SaveGradient, failing rather
+// than replacing a gradient already saved as name. Imported gradients are
+// added with it so an import never overwrites a saved gradient
+func AddGradient(dir, name string, gt *GradientTable) error {
+	if err := checkGradientName(name); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(dir, name+".json")); err == nil {
+		return fmt.Errorf("a gradient named %q is already saved", name)
+	}
+	return SaveGradient(dir, name, gt)
+}
+
+// Renames the gradient saved in dir as <from>.json to <to>.json, failing
+// rather than replacing a gradient already named to. The gradients in dir
+// are not reloaded
+func RenameGradient(dir, from, to string) error {
+	if err := checkGradientName(from); err != nil {
+		return err
+	}
+	if err := checkGradientName(to); err != nil {
+		return err
+	}
+	fromPath := filepath.Join(dir, from+".json")
+	if _, err := os.Stat(fromPath); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no saved gradient named %q", from)
+		}
+		return err
+	}
+	toPath := filepath.Join(dir, to+".json")
+	if _, err := os.Stat(toPath); err == nil {
+		return fmt.Errorf("a gradient named %q is already saved", to)
+	}
+	return os.Rename(fromPath, toPath)
+}
+
+// Deletes the gradient saved in dir as <name>.json. The gradients in dir are
+// not reloaded
+func DeleteGradient(dir, name string) error {
+	if err := checkGradientName(name); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(dir, name+".json"))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no saved gradient named %q", name)
+	}
+	return err
+}
@@ -0,0 +1,176 @@
+package lcv
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// Returns a gradient from one colour to another
+func twoStopGradient(from, to string) *GradientTable {
+	return &GradientTable{Stops: []GradientStop{
+		{Col: MustParseHex(from), Pos: 0},
+		{Col: MustParseHex(to), Pos: 1},
+	}}
+}
+
+// Creates a temporary gradient directory, the user gradients loaded from it
+// are cleared by the returned function
+func tempGradientDir(t *testing.T) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "gradients")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() {
+		os.RemoveAll(dir)
+		LoadGradientDir("")
+	}
+}
+
+func TestGradientLibrary(t *testing.T) {
+	dir, cleanup := tempGradientDir(t)
+	defer cleanup()
+
+	// A saved gradient is normalised and loaded under its name
+	reversed := &GradientTable{Stops: []GradientStop{
+		{Col: MustParseHex("#0000ff"), Pos: 1},
+		{Col: MustParseHex("#ff0000"), Pos: 0},
+	}}
+	if err := SaveGradient(dir, "sunset", reversed); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddGradient(dir, "dawn", twoStopGradient("#000000", "#ffffff")); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadGradientDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if names := UserGradientNames(); !reflect.DeepEqual(names, []string{"dawn", "sunset"}) {
+		t.Errorf("the user gradients are %q, want dawn and sunset", names)
+	}
+	gt, err := GradientByName("sunset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStops(t, "sunset", gt, "", []testStop{{"#ff0000", 0, ""}, {"#0000ff", 1, ""}})
+
+	// SaveGradient replaces a gradient, AddGradient does not
+	if err := AddGradient(dir, "sunset", twoStopGradient("#00ff00", "#00ff00")); err == nil {
+		t.Error("added a gradient over a saved one")
+	}
+	if err := SaveGradient(dir, "sunset", twoStopGradient("#00ff00", "#0000ff")); err != nil {
+		t.Fatal(err)
+	}
+	if gt, err := readGradientFile(filepath.Join(dir, "sunset.json")); err != nil || gt.Stops[0].Col.Hex() != "#00ff00" {
+		t.Errorf("the replaced gradient is %v, %v", gt, err)
+	}
+
+	// Renaming onto a saved gradient fails and keeps both
+	if err := RenameGradient(dir, "sunset", "dawn"); err == nil {
+		t.Error("renamed a gradient over a saved one")
+	}
+	if err := RenameGradient(dir, "missing", "other"); err == nil {
+		t.Error("renamed a gradient which is not saved")
+	}
+	if err := RenameGradient(dir, "sunset", "dusk"); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteGradient(dir, "dawn"); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteGradient(dir, "dawn"); err == nil {
+		t.Error("deleted a gradient which is not saved")
+	}
+	if err := LoadGradientDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if names := UserGradientNames(); !reflect.DeepEqual(names, []string{"dusk"}) {
+		t.Errorf("after renaming and deleting the user gradients are %q, want dusk", names)
+	}
+}
+
+func TestGradientNames(t *testing.T) {
+	dir, cleanup := tempGradientDir(t)
+	defer cleanup()
+
+	gt := twoStopGradient("#000000", "#ffffff")
+	if err := SaveGradient(dir, "valid", gt); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"", "../x", "a/b", ".hidden", "..", "default", "starboy"} {
+		if err := SaveGradient(dir, name, gt); err == nil {
+			t.Errorf("saved a gradient named %q", name)
+		}
+		if err := AddGradient(dir, name, gt); err == nil {
+			t.Errorf("added a gradient named %q", name)
+		}
+		if err := RenameGradient(dir, "valid", name); err == nil {
+			t.Errorf("renamed a gradient to %q", name)
+		}
+		if err := DeleteGradient(dir, name); err == nil {
+			t.Errorf("deleted a gradient named %q", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "x.json")); err == nil {
+		t.Error("a gradient was saved outside the directory")
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("invalid names left %d files, want only valid.json", len(files))
+	}
+}
+
+func TestLoadGradientDir(t *testing.T) {
+	dir, cleanup := tempGradientDir(t)
+	defer cleanup()
+
+	if err := SaveGradient(dir, "sunset", twoStopGradient("#ff0000", "#0000ff")); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadGradientDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// An invalid file keeps the version loaded before, a file named after a
+	// built in gradient is refused and both are reported
+	if err := ioutil.WriteFile(filepath.Join(dir, "sunset.json"), []byte(`{"stops": [`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "starboy.json"), []byte(`{"stops": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadGradientDir(dir); err == nil {
+		t.Error("loading invalid gradients returned no error")
+	}
+	if names := UserGradientNames(); !reflect.DeepEqual(names, []string{"sunset"}) {
+		t.Errorf("the user gradients are %q, want sunset", names)
+	}
+	if gt, err := GradientByName("sunset"); err != nil || gt.Stops[0].Col.Hex() != "#ff0000" {
+		t.Errorf("the invalid gradient is %v, %v, want the previous version", gt, err)
+	}
+
+	// Reloads racing each other keep the previous version of the invalid
+	// gradient, run with -race to check the gradients are guarded
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			LoadGradientDir(dir)
+			UserGradientNames()
+			GradientByName("sunset")
+		}()
+	}
+	wg.Wait()
+	if gt, err := GradientByName("sunset"); err != nil || gt.Stops[0].Col.Hex() != "#ff0000" {
+		t.Errorf("after racing reloads the invalid gradient is %v, %v, want the previous version", gt, err)
+	}
+
+	// A missing directory has no gradients
+	if err := LoadGradientDir(filepath.Join(dir, "missing")); err != nil || len(UserGradientNames()) != 0 {
+		t.Errorf("a missing directory loaded %q, %v", UserGradientNames(), err)
+	}
+}
@@ -0,0 +1,244 @@
+package lcv
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The severity of a log message, messages below the level of a logger are
+// discarded
+type LogLevel int
+
+const (
+	// Detailed tracing, including the per frame logs when they are sampled
+	LevelDebug LogLevel = iota
+	// Changes of state such as starting, stopping and reloading
+	LevelInfo
+	// Problems which the analyser recovers from, such as a failed send
+	LevelWarn
+	// Problems which stop something from working
+	LevelError
+	// Discards every message
+	LevelOff
+)
+
+// The names of the levels as they are written and parsed
+var logLevelNames = [...]string{"debug", "info", "warn", "error", "off"}
+
+// Returns the name of the level
+func (l LogLevel) String() string {
+	if l < LevelDebug || l > LevelOff {
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+	return logLevelNames[l]
+}
+
+// Parses the name of a level, e.g. "debug" or "warn"
+func ParseLogLevel(s string) (LogLevel, error) {
+	for i, name := range logLevelNames {
+		if strings.EqualFold(strings.TrimSpace(s), name) {
+			return LogLevel(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q, expected one of %s", s, strings.Join(logLevelNames[:], ", "))
+}
+
+// Allows the level to be set by a flag
+func (l *LogLevel) Set(s string) error {
+	level, err := ParseLogLevel(s)
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// Writes levelled messages as lines of key=value fields, e.g.
+//
+//	time=2020-05-01T18:04:05.000Z level=warn msg="sending failed" output="led lights" err="..."
+//
+// A Logger is safe to use from several goroutines and a nil Logger discards
+// everything
+type Logger struct {
+	mu sync.Mutex
+	// where the lines are written
+	out io.Writer
+	// the lowest level which is written
+	level LogLevel
+	// every how many frames the per frame logs are written, 0 disables them
+	frameEvery int
+	// the number of frames counted since the last sampled frame
+	frames int
+}
+
+// Generates a logger writing messages at or above level to out, with the
+// per frame logs disabled
+func NewLogger(out io.Writer, level LogLevel) *Logger {
+	return &Logger{out: out, level: level}
+}
+
+// The logger used by the analysers, outputs and the gui unless they are
+// given another
+var defaultLogger = NewLogger(os.Stderr, LevelInfo)
+
+// Returns the package's default logger, which writes info and above to
+// stderr until it is changed
+func DefaultLogger() *Logger {
+	return defaultLogger
+}
+
+// Sets where the lines are written
+func (l *Logger) SetOutput(out io.Writer) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out = out
+}
+
+// Sets the lowest level which is written
+func (l *Logger) SetLevel(level LogLevel) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = level
+}
+
+// Returns the lowest level which is written
+func (l *Logger) Level() LogLevel {
+	if l == nil {
+		return LevelOff
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.level
+}
+
+// Sets every how many audio frames the per frame debug logs are written, so
+// the analysis can be traced without a line for every frame. 0 disables
+// them, which is the default. They are only written at the debug level
+func (l *Logger) SetFrameSampling(every int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if every < 0 {
+		every = 0
+	}
+	l.frameEvery = every
+	l.frames = 0
+}
+
+// Reports whether a message at level would be written, so expensive fields
+// are only computed when they are needed
+func (l *Logger) Enabled(level LogLevel) bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return level >= l.level && l.level != LevelOff
+}
+
+// Counts a frame and reports whether its per frame logs should be written.
+// It is called once for every frame the analyser produces
+func (l *Logger) sampleFrame() bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.frameEvery == 0 || l.level > LevelDebug {
+		return false
+	}
+	l.frames++
+	if l.frames < l.frameEvery {
+		return false
+	}
+	l.frames = 0
+	return true
+}
+
+// Writes a debug message, fields are alternating keys and values
+func (l *Logger) Debug(msg string, fields ...interface{}) {
+	l.log(LevelDebug, msg, fields)
+}
+
+// Writes an info message, fields are alternating keys and values
+func (l *Logger) Info(msg string, fields ...interface{}) {
+	l.log(LevelInfo, msg, fields)
+}
+
+// Writes a warning, fields are alternating keys and values
+func (l *Logger) Warn(msg string, fields ...interface{}) {
+	l.log(LevelWarn, msg, fields)
+}
+
+// Writes an error, fields are alternating keys and values
+func (l *Logger) Error(msg string, fields ...interface{}) {
+	l.log(LevelError, msg, fields)
+}
+
+// Formats a message and its fields as one line and writes it
+func (l *Logger) log(level LogLevel, msg string, fields []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("time=")
+	b.WriteString(time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00"))
+	b.WriteString(" level=")
+	b.WriteString(level.String())
+	b.WriteString(" msg=")
+	b.WriteString(logValue(msg))
+	for i := 0; i < len(fields); i += 2 {
+		b.WriteByte(' ')
+		b.WriteString(fmt.Sprint(fields[i]))
+		b.WriteByte('=')
+		if i+1 < len(fields) {
+			b.WriteString(logValue(fields[i+1]))
+		} else {
+			b.WriteString(`"MISSING"`)
+		}
+	}
+	b.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.out, b.String())
+}
+
+// Formats a field's value, quoting it if it is empty or contains spaces,
+// quotes or equals signs so the line can be split back into fields
+func logValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	case float64:
+		s = strconv.FormatFloat(v, 'g', 6, 64)
+	case float32:
+		s = strconv.FormatFloat(float64(v), 'g', 6, 32)
+	case time.Duration:
+		s = v.String()
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,149 @@
+package lcv
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns the lines written to a buffer with the time field removed
+func logLines(buf *bytes.Buffer) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		if i := strings.Index(line, " "); strings.HasPrefix(line, "time=") && i >= 0 {
+			line = line[i+1:]
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestLoggerFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		msg    string
+		fields []interface{}
+		want   string
+	}{
+		{"no fields", "started", nil, "level=info msg=started"},
+		{"quoted message", "sending failed", nil, `level=info msg="sending failed"`},
+		{"string", "x", []interface{}{"output", "led lights"}, `level=info msg=x output="led lights"`},
+		{"empty string", "x", []interface{}{"device", ""}, `level=info msg=x device=""`},
+		{"equals sign", "x", []interface{}{"expr", "a=b"}, `level=info msg=x expr="a=b"`},
+		{"error", "x", []interface{}{"err", errors.New("no route")}, `level=info msg=x err="no route"`},
+		{"numbers", "x", []interface{}{"hz", 440, "db", -12.25, "gain", float32(0.5)}, "level=info msg=x hz=440 db=-12.25 gain=0.5"},
+		{"duration", "x", []interface{}{"took", 1500 * time.Millisecond}, "level=info msg=x took=1.5s"},
+		{"missing value", "x", []interface{}{"key"}, `level=info msg=x key="MISSING"`},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		l := NewLogger(&buf, LevelDebug)
+		l.Info(tt.msg, tt.fields...)
+		if got := logLines(&buf); len(got) != 1 || got[0] != tt.want {
+			t.Errorf("%s: wrote %q, want %q", tt.name, got, tt.want)
+		}
+		if !strings.HasPrefix(buf.String(), "time=") {
+			t.Errorf("%s: the line %q does not start with the time", tt.name, buf.String())
+		}
+	}
+}
+
+func TestLoggerLevels(t *testing.T) {
+	tests := []struct {
+		level LogLevel
+		want  []string
+	}{
+		{LevelDebug, []string{"level=debug msg=d", "level=info msg=i", "level=warn msg=w", "level=error msg=e"}},
+		{LevelInfo, []string{"level=info msg=i", "level=warn msg=w", "level=error msg=e"}},
+		{LevelWarn, []string{"level=warn msg=w", "level=error msg=e"}},
+		{LevelError, []string{"level=error msg=e"}},
+		{LevelOff, nil},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		l := NewLogger(&buf, LevelInfo)
+		l.SetLevel(tt.level)
+		l.Debug("d")
+		l.Info("i")
+		l.Warn("w")
+		l.Error("e")
+		if got := logLines(&buf); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("at %s wrote %q, want %q", tt.level, got, tt.want)
+		}
+		if l.Level() != tt.level {
+			t.Errorf("the level is %s, want %s", l.Level(), tt.level)
+		}
+	}
+
+	for _, name := range []string{"debug", " WARN ", "off"} {
+		if _, err := ParseLogLevel(name); err != nil {
+			t.Errorf("parsing %q: %v", name, err)
+		}
+	}
+	if _, err := ParseLogLevel("verbose"); err == nil {
+		t.Error("parsed an unknown level")
+	}
+}
+
+func TestLoggerFrameSampling(t *testing.T) {
+	tests := []struct {
+		level   LogLevel
+		every   int
+		sampled []int
+	}{
+		{LevelDebug, 0, nil},
+		{LevelDebug, 1, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{LevelDebug, 3, []int{3, 6, 9}},
+		{LevelDebug, -2, nil},
+		// The frames are only logged at the debug level
+		{LevelInfo, 3, nil},
+	}
+
+	for _, tt := range tests {
+		l := NewLogger(&bytes.Buffer{}, tt.level)
+		l.SetFrameSampling(tt.every)
+		var sampled []int
+		for frame := 1; frame <= 10; frame++ {
+			if l.sampleFrame() {
+				sampled = append(sampled, frame)
+			}
+		}
+		if len(sampled) != len(tt.sampled) {
+			t.Errorf("every %d at %s sampled frames %v, want %v", tt.every, tt.level, sampled, tt.sampled)
+			continue
+		}
+		for i := range sampled {
+			if sampled[i] != tt.sampled[i] {
+				t.Errorf("every %d at %s sampled frames %v, want %v", tt.every, tt.level, sampled, tt.sampled)
+				break
+			}
+		}
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	// A nil logger discards everything and can be configured
+	var l *Logger
+	l.SetOutput(&bytes.Buffer{})
+	l.SetLevel(LevelDebug)
+	l.SetFrameSampling(1)
+	l.Info("discarded", "key", "value")
+	if l.Enabled(LevelError) || l.sampleFrame() || l.Level() != LevelOff {
+		t.Error("a nil logger is enabled")
+	}
+
+	var buf bytes.Buffer
+	l = NewLogger(&bytes.Buffer{}, LevelInfo)
+	l.SetOutput(&buf)
+	l.Warn("moved")
+	if got := logLines(&buf); len(got) != 1 || got[0] != "level=warn msg=moved" {
+		t.Errorf("after moving the output wrote %q", got)
+	}
+}
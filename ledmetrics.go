@@ -0,0 +1,159 @@
+package lcv
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// How much each new measurement moves the averaged timings, the averages
+// follow roughly the last 20 frames
+const metricsAlpha = 0.05
+
+// Measurements of how the analysis is keeping up, used to find whether
+// stutter in the lights comes from the analyser or from further along
+type Metrics struct {
+	// Whether the analyser is running
+	Running bool `json:"running"`
+	// The number of frames analysed since the analyser started
+	Frames uint64 `json:"frames"`
+	// The number of frames analysed per second, over the last second
+	FPS float64 `json:"fps"`
+	// The time taken by the FFT of each frame in milliseconds, averaged
+	FFTMillis float64 `json:"fftMillis"`
+	// The time from reading the audio from the stream to sending its colour
+	// to the outputs in milliseconds, averaged
+	LatencyMillis float64 `json:"latencyMillis"`
+	// The number of frames which were not delivered to the frame channel
+	// because its receiver was not keeping up
+	DroppedFrames uint64 `json:"droppedFrames"`
+	// The number of frames which took longer to analyse than the audio they
+	// were made from, so the analysis fell behind the stream
+	LateFrames uint64 `json:"lateFrames"`
+	// The number of times the audio stream overflowed because it was not
+	// read quickly enough, losing audio
+	Overflows uint64 `json:"overflows"`
+	// The number of colours which failed to send to an output
+	UDPErrors uint64 `json:"udpErrors"`
+	// The scale applied to the brightness of the colours sent to the outputs
+	// by the brightness cap and the power limits, that of the most dimmed
+	// output
+	Gain float64 `json:"gain"`
+	// The current the leds of the outputs with a power budget are estimated
+	// to draw in mA, in total
+	CurrentMilliamps float64 `json:"currentMilliamps"`
+}
+
+// The metrics recorded by the analysis loop. They have their own lock so
+// reading them never holds up the configuration of the analyser
+type analyserMetrics struct {
+	mu sync.Mutex
+	m  Metrics
+	// The start of the second the fps is being counted over and the frames
+	// counted in it so far
+	windowStart  time.Time
+	windowFrames int
+}
+
+// Clears the metrics as the analyser starts
+func (am *analyserMetrics) reset() {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	am.m = Metrics{Running: true, Gain: 1}
+	am.windowStart = time.Now()
+	am.windowFrames = 0
+}
+
+// Marks the analyser as stopped, the counts are kept until it next starts
+func (am *analyserMetrics) stop() {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	am.m.Running = false
+	am.m.FPS = 0
+}
+
+// Records a frame which has been analysed and sent, fft is the time the FFT
+// took, latency the time since the audio was read and late whether the
+// frame took longer than the audio it was made from. gain and current are
+// the brightness and the current the colour was sent with
+func (am *analyserMetrics) frame(fft, latency time.Duration, late bool, gain, current float64) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	fftMillis := float64(fft) / float64(time.Millisecond)
+	latencyMillis := float64(latency) / float64(time.Millisecond)
+	if am.m.Frames == 0 {
+		am.m.FFTMillis, am.m.LatencyMillis = fftMillis, latencyMillis
+	} else {
+		am.m.FFTMillis += metricsAlpha * (fftMillis - am.m.FFTMillis)
+		am.m.LatencyMillis += metricsAlpha * (latencyMillis - am.m.LatencyMillis)
+	}
+	am.m.Gain = gain
+	am.m.CurrentMilliamps = current
+	am.m.Frames++
+	if late {
+		am.m.LateFrames++
+	}
+
+	am.windowFrames++
+	if elapsed := time.Since(am.windowStart); elapsed >= time.Second {
+		am.m.FPS = float64(am.windowFrames) / elapsed.Seconds()
+		am.windowStart = time.Now()
+		am.windowFrames = 0
+	}
+}
+
+// Counts a frame which the frame channel could not take
+func (am *analyserMetrics) droppedFrame() {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.m.DroppedFrames++
+}
+
+// Counts an overflow of the audio stream
+func (am *analyserMetrics) overflow() {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.m.Overflows++
+}
+
+// Counts a colour which failed to send
+func (am *analyserMetrics) udpError() {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.m.UDPErrors++
+}
+
+// Returns a copy of the metrics
+func (am *analyserMetrics) snapshot() Metrics {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	return am.m
+}
+
+// Returns the analyser's current metrics, the counts cover the latest run
+func (aa *AudioAnalyser) Metrics() Metrics {
+	return aa.metrics.snapshot()
+}
+
+// Lock making the check for a published name and the publishing one step
+var publishMu sync.Mutex
+
+// Publishes the analyser's metrics as an expvar variable with the given
+// name, so they are served as json at /debug/vars by any http server using
+// http.DefaultServeMux. An error is returned if the name is already taken,
+// expvar variables cannot be removed once they are published
+func (aa *AudioAnalyser) PublishMetrics(name string) error {
+	publishMu.Lock()
+	defer publishMu.Unlock()
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("the metrics name %q is already published", name)
+	}
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return aa.Metrics()
+	}))
+	return nil
+}
@@ -0,0 +1,46 @@
+package lcv
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+)
+
+func TestPublishMetrics(t *testing.T) {
+	aa, err := New(WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := aa.PublishMetrics("test analyser"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The variable is the analyser's metrics as json
+	v := expvar.Get("test analyser")
+	if v == nil {
+		t.Fatal("the metrics were not published")
+	}
+	var m Metrics
+	if err := json.Unmarshal([]byte(v.String()), &m); err != nil {
+		t.Fatalf("the metrics %s are not json: %v", v.String(), err)
+	}
+	if m != aa.Metrics() {
+		t.Errorf("published %+v, want %+v", m, aa.Metrics())
+	}
+
+	// A name which is taken is an error rather than a panic, and the first
+	// analyser keeps the name
+	other, err := New(WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.PublishMetrics("test analyser"); err == nil {
+		t.Error("published the metrics under a name which is taken")
+	}
+	if err := aa.PublishMetrics("test analyser"); err == nil {
+		t.Error("published the metrics twice")
+	}
+	if err := other.PublishMetrics("other analyser"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,214 @@
+package lcv
+
+import (
+	"errors"
+	"strings"
+)
+
+// The parameters of an analyser. The colour mapping, Graph and Brightness
+// can be changed while it runs, the parameters which shape the audio stream
+// only change when it is next started
+type Params struct {
+	// The maximum f the program will clamp to, changes while running
+	FCap float64 `json:"fCap"`
+	// The upper range of frequencies the program considers useful.
+	// After this barrier, the colour changes very slowly in relation
+	// to change in f. Changes while running
+	UsefulCap float64 `json:"usefulCap"`
+	// The total range of hues to use for the hsv colour spectrum
+	// e.g. the first 200 hues. Changes while running
+	TotalHue float64 `json:"totalHue"`
+	// The hue colour at which the usefulCap is reached, changes while
+	// running
+	FCapHue float64 `json:"fCapHue"`
+	// The length of the buffer used to store the audio data, applies on the
+	// next start
+	BufferLength int `json:"bufferLength"`
+	// The sample rate every input is converted to before analysis, so the
+	// colours do not depend on the sample rate of the device. 0 analyses
+	// the audio at the rate of the device. Applies on the next start
+	SampleRate float64 `json:"sampleRate"`
+	// The factor the audio is decimated by before analysis, higher factors
+	// give a finer frequency resolution for the bass. Applies on the next
+	// start
+	Decimation int `json:"decimation"`
+	// Should a graph be created after visualisation is stopped, changes
+	// while running
+	Graph bool `json:"graph"`
+	// The maximum number of audio chunks kept for the spectrogram, older
+	// chunks are discarded to bound memory use. Applies on the next start
+	SpectrogramFrames int `json:"spectrogramFrames"`
+	// The most brightness the colours are sent to the outputs with, in the
+	// range (0, 1]. The gui preview is not dimmed. Changes while running
+	Brightness float64 `json:"brightness"`
+}
+
+// Returns the parameters an analyser uses unless WithParams is given
+func DefaultParams() Params {
+	return Params{
+		FCap:              2500,
+		UsefulCap:         1200,
+		TotalHue:          320,
+		FCapHue:           310,
+		BufferLength:      1024 * 2,
+		SampleRate:        44100,
+		Decimation:        1,
+		SpectrogramFrames: 3000,
+		Brightness:        1,
+	}
+}
+
+// Returns the filter settings an analyser uses unless WithFilterParams is
+// given
+func DefaultFilterParams() FilterParams {
+	return FilterParams{
+		Smooth:      true,
+		SmoothAlpha: 0.73,
+		Damp:        true,
+		DampLength:  4,
+	}
+}
+
+// Checks the parameters can be used by an analyser
+func (p Params) validate() error {
+	if problems := p.problems("params."); len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Configures an analyser when it is created by New
+type Option func(aa *AudioAnalyser) error
+
+// Sets the parameters, gradient, filter, input device, spectrogram and
+// outputs of the analyser from a config, which is validated first
+func WithConfig(c Config) Option {
+	return func(aa *AudioAnalyser) error {
+		return aa.ApplyConfig(c)
+	}
+}
+
+// Sets the parameters of the analyser, replacing DefaultParams
+func WithParams(p Params) Option {
+	return func(aa *AudioAnalyser) error {
+		return aa.SetParams(p)
+	}
+}
+
+// Sets the function called with every analysed frame. It is called from
+// the analysis goroutine so it should return quickly
+func WithFrameCallback(f func(Frame)) Option {
+	return func(aa *AudioAnalyser) error {
+		aa.cb = f
+		return nil
+	}
+}
+
+// Sets a channel every analysed frame is sent to. The analyser never blocks
+// on the channel, frames are dropped if it is full
+func WithFrameChannel(c chan<- Frame) Option {
+	return func(aa *AudioAnalyser) error {
+		aa.frames = c
+		return nil
+	}
+}
+
+// Sets the gradient used to colour the audio, see SetGradient
+func WithGradient(gt *GradientTable) Option {
+	return func(aa *AudioAnalyser) error {
+		aa.SetGradient(gt)
+		return nil
+	}
+}
+
+// Sets the gradient used to colour the audio by name, see SetGradientName
+func WithGradientName(name string) Option {
+	return func(aa *AudioAnalyser) error {
+		return aa.SetGradientName(name)
+	}
+}
+
+// Sets the curve mapping the frequency to a position in the gradient, see
+// SetCurve
+func WithCurve(c *FrequencyCurve) Option {
+	return func(aa *AudioAnalyser) error {
+		return aa.SetCurve(c)
+	}
+}
+
+// Sets the smoothing, damping and input filter settings
+func WithFilterParams(p FilterParams) Option {
+	return func(aa *AudioAnalyser) error {
+		return aa.SetFilterParams(p)
+	}
+}
+
+// Sets the destinations the colours are sent to, see SetOutputs
+func WithOutputs(targets []OutputTarget) Option {
+	return func(aa *AudioAnalyser) error {
+		return aa.SetOutputs(targets)
+	}
+}
+
+// Sets the start of the name of the input device
+func WithInputDevice(name string) Option {
+	return func(aa *AudioAnalyser) error {
+		aa.SetInputDevice(name)
+		return nil
+	}
+}
+
+// Sets whether a spectrogram is created when the analyser stops
+func WithSpectrogram(enabled bool) Option {
+	return func(aa *AudioAnalyser) error {
+		aa.SetSpectrogram(enabled)
+		return nil
+	}
+}
+
+// Sets the logger the analyser writes to, nil discards its logs. The
+// default logger is used otherwise
+func WithLogger(l *Logger) Option {
+	return func(aa *AudioAnalyser) error {
+		aa.log = l
+		return nil
+	}
+}
+
+// Creates an analyser with the default configuration changed by the options.
+// The analyser does nothing until Start is called, its frames are delivered
+// through WithFrameCallback or WithFrameChannel
+func New(opts ...Option) (*AudioAnalyser, error) {
+	def := DefaultConfig()
+	aa := &AudioAnalyser{
+		u: &analysisUnits{
+			tempo: newTempoTracker(),
+		},
+		lg:        &analysisLogs{},
+		log:       DefaultLogger(),
+		openInput: openPortaudio,
+		metrics: analyserMetrics{
+			m: Metrics{Gain: 1},
+		},
+		cfg: runtimeConfig{
+			params:      def.Params,
+			filter:      def.Filter,
+			outputs:     def.Outputs,
+			inputDevice: def.InputDevice,
+			spectrogram: def.Spectrogram,
+		},
+	}
+
+	for _, opt := range opts {
+		if err := opt(aa); err != nil {
+			return nil, err
+		}
+	}
+
+	return aa, nil
+}
+
+// Returns the parameters of the analyser, see SetParams
+func (aa *AudioAnalyser) Params() Params {
+	return aa.Snapshot().Params
+}
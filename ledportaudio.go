@@ -1,69 +1,76 @@
 package lcv
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	_ "github.com/andlabs/ui/winmanifest"
 	"github.com/gordonklaus/portaudio"
 	colorful "github.com/lucasb-eyer/go-colorful"
+	"github.com/nadav-rahimi/led-colour-visualiser/dspsingle"
 	"github.com/nadav-rahimi/led-colour-visualiser/fftsingle"
-	"log"
+	"math"
 	"math/cmplx"
 	"strings"
+	"sync"
 	"time"
 )
 
+var (
+	// Returned by Start when no input device matches the configured name
+	ErrDeviceNotFound = errors.New("input device not found")
+	// Returned by Start when the analyser is already running
+	ErrAlreadyRunning = errors.New("analyser is already running")
+)
+
 // The Audio Analyser
 type AudioAnalyser struct {
 	// Parameters to initialise the analyser
-	param *AudioAnalysisParams
+	param Params
 	// The units the analyser uses during processing
-	u *AudioAnalysisUnits
+	u *analysisUnits
 	// Contains the slices which the analyser logs to
-	lg *AudioAnalysisLogs
-	// The callback function which the analyser calls with the hue of the frequency
-	cb func(uint32)
-	// The handler for the udp stream
-	udph *AudioAnalysisUDPHandler
-}
-
-// Parameters for setting up the analyser
-type AudioAnalysisParams struct {
-	// The maximum f the program will clamp to
-	fCap float64
-	// The upper range of frequencies the program considers useful.
-	// After this barrier, the colour changes very slowly in relation
-	// to change in f
-	usefulCap float64
-	// The total range of hues to use for the hsv colour spectrum
-	// e.g. the first 200 hues
-	totalHue float64
-	// The hue colour at which the usefulCap is reached
-	fCapHue float64
-	// The length of the buffer used to store the audio data
-	bufferLength int
-	// This is the length the program uses to find the f with
-	// the highest magnitude, this is half the buffer length because
-	// the FFT is mirrored along the centre, thus only half the length
-	// needs to be used
-	bufferLengthUseful float64
-	// The length of the array to use for damping
-	freqArrayL int
-	// Whether to enable damping
-	damp bool
-	// Whether to enable smoothing
-	smooth bool
-	// Smoothing alpha
-	smoothA float64
-	// Should a graph be created after visualisation is stopped stops
-	creatVis bool
-	// The name of the gradient to use for audio colouring
-	gradName string
-	// THe start of the name of the sound input device which portaudio reads from
-	inputDeviceName string
+	lg *analysisLogs
+	// The callback function which the analyser calls with each frame, nil
+	// if no callback is set
+	cb func(Frame)
+	// The channel each frame is sent to, nil if no channel is set
+	frames chan<- Frame
+	// The logger the analyser writes to, nil discards the logs
+	log *Logger
+	// Opens the audio stream, from portaudio's input devices unless it is
+	// replaced by a test
+	openInput openInputFunc
+	// Measurements of how the analysis is keeping up
+	metrics analyserMetrics
+	// The udp clients which the colours are sent to, one for each enabled
+	// output target. Only used by the analysis loop
+	outputs []*output
+
+	// Lock guarding the fields below which are shared between the analysis
+	// loop and the goroutines configuring it
+	mu sync.Mutex
+	// The settings requested through the runtime api
+	cfg runtimeConfig
+	// Set when cfg has changed since the analysis loop last applied it
+	dirty bool
+	// The latest results of the analysis loop
+	status analyserStatus
+	// States whether the analyser is running
+	isRunning bool
+	// The sample rate of the open audio stream, 0 while it is not open
+	streamRate float64
+	// The parameters the open audio stream was shaped with
+	streamParams Params
+	// Cancels the context of the analysis loop, nil when it is not running
+	cancel context.CancelFunc
+	// Closed when the analysis loop of the latest run has exited
+	done chan struct{}
+	// The error which ended the latest run
+	runErr error
 }
 
 // Stores values the analyser uses during computation
-type AudioAnalysisUnits struct {
+type analysisUnits struct {
 	// Array holding the past few max frequencies used for
 	// damping
 	farr []int
@@ -81,46 +88,78 @@ type AudioAnalysisUnits struct {
 	// found
 	index int
 	// This represents the difference in frequency between
-	// each index of the bfft array
-	fBinSize int
+	// each index of the bfft array in Hz, kept fractional as
+	// the rate after decimation rarely divides evenly
+	fBinSize float64
 	// Buffer to hold the calculated FFT of the audio stream
 	bfft []complex64
+	// The short-time Fourier transform each chunk is a segment of, the
+	// chunks are already framed and overlapped by the input stage
+	stft fftsingle.STFTOptions
 	// Enables or disables the use of custom gradients
 	gtUsed bool
 	// The gradient table used for custom gradients
 	aaGT *GradientTable
-	// Stop signal
-	stopSig chan bool
-	// States whether the analyser is running
-	isRunning bool
+	// The curve mapping the frequency to a position, nil if the gradient's
+	// curve or the parameters are used
+	curve *FrequencyCurve
+	// Buffer the audio stream is read into
+	buffer []float32
+	// Estimates the tempo of the audio from each audio chunk
+	tempo *tempoTracker
+	// The sample rate of the input stream
+	sampleRate float64
+	// The filters applied to the input stream before analysis, nil if
+	// no filtering is enabled
+	prefilter inputFilters
+	// This is the length the program uses to find the f with
+	// the highest magnitude, this is half the buffer length because
+	// the FFT is mirrored along the centre, thus only half the length
+	// needs to be used
+	bufferLengthUseful float64
+	// The smoothing, damping and input filter settings, copied from the
+	// runtime config between audio chunks
+	filter FilterParams
+	// Should a spectrogram be created after visualisation is stopped
+	creatSpec bool
+	// THe start of the name of the sound input device which portaudio reads from
+	inputDeviceName string
+	// When the block of audio being analysed was read from the stream
+	readTime time.Time
+	// The length of audio each chunk moves the analysis forward by, a chunk
+	// taking longer than this to analyse is late
+	framePeriod time.Duration
+	// When the analysis started, the time animated gradients are sampled at
+	// is measured from it
+	startTime time.Time
 }
 
 // The slices which the analyser logs to for graphing
-type AudioAnalysisLogs struct {
+type analysisLogs struct {
 	// Buffer to hold the original calculated frequency for each audio chunk
 	freqLog []int
 	// Buffer to hold the damped frequency for each audio chunk
 	dampLog []int
 	// Buffer to hold the smoothed frequency for each audio chunk
 	smthLog []int
+	// Records the spectrum of each audio chunk for the spectrogram
+	spec *spectrogramRecorder
 }
 
-// Handles the sending of the colour data to the arduino through a udp stream
-type AudioAnalysisUDPHandler struct {
-	// The UDP client
+// Sends the colour data to an output target through a udp stream
+type output struct {
+	// The settings of the target
+	target OutputTarget
+	// The UDP client connected to the target
 	client *udpC
-	// Decides if the client should attempt to send a message over the UDP stream
-	shouldsend bool
-	// States whether the UDP client is running or not
-	running bool
 }
 
 // From the fft array, the index of the f with the highest magnitude is returned
-func (aa AudioAnalyser) maxFreqInd() int {
+func (aa *AudioAnalyser) maxFreqInd() int {
 	var max_v float64 = 0
 	var index int = 0
 
-	for i := 1; i < int(aa.param.bufferLengthUseful); i++ {
+	for i := 1; i < int(aa.u.bufferLengthUseful); i++ {
 		e := cmplx.Abs(complex128(aa.u.bfft[i]))
 		if e > max_v {
 			max_v = e
@@ -131,227 +170,592 @@ func (aa AudioAnalyser) maxFreqInd() int {
 	return index
 }
 
-// Converts the frequency calculated to a uint32 colour
-func (aa AudioAnalyser) colourUINT32() uint32 {
+// Converts the frequency calculated to a colour
+func (aa *AudioAnalyser) colour() colorful.Color {
+	// A curve takes the place of the parameters, the analyser's curve comes
+	// before the gradient's
+	curve := aa.u.curve
+	if curve == nil && aa.u.gtUsed {
+		curve = aa.u.aaGT.Curve
+	}
+	// Animated gradients are sampled at the time since the analysis started,
+	// or at the beats since then if they follow the tempo
+	seconds := time.Since(aa.u.startTime).Seconds()
+	beats := aa.u.tempo.beats()
+	if curve != nil {
+		pos := curve.position(float64(*aa.u.f))
+		if aa.u.gtUsed {
+			return aa.u.aaGT.ColourAt(pos, seconds, beats)
+		}
+		return colorful.Hsv(pos*aa.param.TotalHue, 1, 1)
+	}
+
 	var h float64
-	if float64(*aa.u.f) > aa.param.usefulCap {
-		h = aa.param.fCapHue + (aa.param.totalHue-aa.param.fCapHue)*(float64(*aa.u.f)/aa.param.fCap)
+	if float64(*aa.u.f) > aa.param.UsefulCap {
+		h = aa.param.FCapHue + (aa.param.TotalHue-aa.param.FCapHue)*(float64(*aa.u.f)/aa.param.FCap)
 	} else {
-		h = float64(*aa.u.f) / aa.param.usefulCap * aa.param.fCapHue
+		h = float64(*aa.u.f) / aa.param.UsefulCap * aa.param.FCapHue
 	}
 
 	if aa.u.gtUsed {
-		return boxColour(aa.u.aaGT.GetInterpolatedColorFor(h / aa.param.totalHue)).UINT32()
+		return aa.u.aaGT.ColourAt(h/aa.param.TotalHue, seconds, beats)
 	}
-	return boxColour(colorful.Hsv(h, 1, 1)).UINT32()
+	return colorful.Hsv(h, 1, 1)
 }
 
 // Takes in the current f and damps it based on past frequencies
-func (aa AudioAnalyser) dampFreqs() {
+func (aa *AudioAnalyser) dampFreqs() {
 	(aa.u.farr)[*aa.u.c] = *aa.u.f
 	*aa.u.c++
 	// Modulus of the counter is taken so farr can be updated without shifting
-	*aa.u.c = *aa.u.c % aa.param.freqArrayL
+	*aa.u.c = *aa.u.c % len(aa.u.farr)
 
 	var total int = 0
 	for _, value := range aa.u.farr {
 		total += value
 	}
 
-	*aa.u.f = total / aa.param.freqArrayL
+	*aa.u.f = total / len(aa.u.farr)
 }
 
 // Smooths the frequencies, alternative damping method, the larger alpha the more
 // the old freq is weighted, alpha is [0, 1]
-func (aa AudioAnalyser) smoothFreqs(alpha float64) {
+func (aa *AudioAnalyser) smoothFreqs(alpha float64) {
 	(*aa.u.f) = int(alpha*float64(*aa.u.old_freq) + (1-alpha)*float64(*aa.u.f))
 }
 
 // Updates the f with the value of the f with the highest magnitude
-func (aa AudioAnalyser) updateFreq() {
-	*aa.u.f = aa.u.fBinSize * aa.u.index
+func (aa *AudioAnalyser) updateFreq() {
+	*aa.u.f = int(aa.u.fBinSize*float64(aa.u.index) + 0.5)
 	// After the cap range our ears dont hear a difference so no use to visualise the cap
-	if float64(*aa.u.f) > aa.param.fCap {
-		*aa.u.f = int(aa.param.fCap)
+	if float64(*aa.u.f) > aa.param.FCap {
+		*aa.u.f = int(aa.param.FCap)
 	}
 }
 
-// Begins analysing audio from an audio stream
-func (aa AudioAnalyser) StartAnalysis() {
-	aa.u.isRunning = true
+// Builds the filters applied to each audio chunk before analysis, nil is
+// returned if no filtering is enabled
+func (aa *AudioAnalyser) newPrefilter(sampleRate float64) inputFilters {
+	var f dspsingle.Cascade
+	if aa.u.filter.HighPassF > 0 {
+		f = append(f, dspsingle.ButterworthHighPass(4, aa.u.filter.HighPassF, sampleRate)...)
+	}
+	if aa.u.filter.HumF > 0 {
+		// The harmonics of the hum are often as loud as the hum itself
+		for h := 1.0; h <= 3; h++ {
+			f = append(f, dspsingle.NewNotch(aa.u.filter.HumF*h, 10, sampleRate))
+		}
+	}
 
-	// Check the gradient table exists if one is to be used
-	if len(aa.param.gradName) > 0 {
-		var err error
-		aa.u.aaGT, err = getGradientTable(aa.param.gradName)
-		chk(err)
-		aa.u.gtUsed = true
+	var filters inputFilters
+	if len(f) > 0 {
+		filters = append(filters, f)
+	}
+	if band := newInputBand(aa.u.filter.BandLowF, aa.u.filter.BandHighF, sampleRate); band != nil {
+		filters = append(filters, band)
 	}
+	return filters
+}
 
-	//Initialise portaudio and create the audio buffer
-	portaudio.Initialize()
-	defer portaudio.Terminate()
+// Filters applied to the input in turn, each changing it in place
+type inputFilters []interface {
+	Process(x []float32)
+}
 
-	buffer := make([]float32, aa.param.bufferLength)
+// Applies every filter to x in turn
+func (fs inputFilters) Process(x []float32) {
+	for _, f := range fs {
+		f.Process(x)
+	}
+}
 
-	// Get the input device
-	devices, err := portaudio.Devices()
-	chk(err)
+// Keeps one band of the input split by Linkwitz-Riley crossovers
+type inputBand struct {
+	splitter *dspsingle.BandSplitter
+	// The index of the band which is kept, from the lowest
+	band int
+}
 
-	var inpDev, outDev *portaudio.DeviceInfo
-	for _, d := range devices {
-		if d.HostApi.Name == "MME" {
-			if strings.HasPrefix(d.Name, aa.param.inputDeviceName) {
-				if d.MaxInputChannels > 0 {
-					inpDev = d
-				}
-			}
+// Generates the filter keeping the band between the crossovers low and
+// high, either of which is 0 to leave that side open. nil is returned if
+// both are 0
+func newInputBand(low, high, sampleRate float64) *inputBand {
+	var crossovers []float64
+	band := 0
+	if low > 0 {
+		crossovers = append(crossovers, low)
+		band = 1
+	}
+	if high > 0 {
+		crossovers = append(crossovers, high)
+	}
+	if len(crossovers) == 0 {
+		return nil
+	}
+	return &inputBand{splitter: dspsingle.NewBandSplitter(4, crossovers, sampleRate), band: band}
+}
+
+// Replaces x with its band
+func (b *inputBand) Process(x []float32) {
+	copy(x, b.splitter.Split(x)[b.band])
+}
+
+// Calculates the colour of a chunk of audio and sends it to the outputs
+func (aa *AudioAnalyser) analyseChunk(chunk []float32) {
+	chunkStart := time.Now()
+
+	// Transform the chunk as a single segment of the STFT, only the first
+	// half of the FFT is kept as the second half is its mirror
+	aa.u.bfft = fftsingle.STFT(chunk, aa.u.stft).Dim([]int{0, -1})
+	fftTime := time.Since(chunkStart)
+
+	// Update the tempo estimate with the useful half of the spectrum
+	aa.u.tempo.update(aa.u.bfft[:int(aa.u.bufferLengthUseful)])
+
+	// Get the index of the f with the largest magnitude
+	aa.u.index = aa.maxFreqInd()
+
+	// Calculate the new frequency
+	*aa.u.old_freq = *aa.u.f
+	aa.updateFreq()
+	raw := *aa.u.f
+	aa.lg.freqLog = append(aa.lg.freqLog, *aa.u.f)
+
+	// Dampening and Smoothing
+	if aa.u.filter.Smooth {
+		aa.smoothFreqs(aa.u.filter.SmoothAlpha)
+		aa.smoothFreqs(0.3)
+		aa.lg.smthLog = append(aa.lg.smthLog, *aa.u.f)
+	}
+	if aa.u.filter.Damp {
+		aa.dampFreqs()
+		aa.lg.dampLog = append(aa.lg.dampLog, *aa.u.f)
+	}
+
+	// Delivering the frame to the callback and channel
+	// The frames show the colour uncalibrated, each output calibrates it
+	// for its leds and adds the white channel if it has one
+	c := aa.colour()
+	colour := ColourUINT32(c)
+	aa.publish(chunk, colour)
+
+	// The frame is traced only when a sampled debug log is wanted
+	if aa.log.sampleFrame() {
+		aa.log.Debug("frame", "frequency", raw, "filtered", *aa.u.f, "colour", fmt.Sprintf("#%06x", colour))
+	}
+
+	// Sending the value through the UDP stream of each output, a failed send
+	// is logged rather than stopping the analysis. The gain reported is that
+	// of the most dimmed output
+	var current float64
+	gain := aa.param.Brightness
+	for _, o := range aa.outputs {
+		value, ma, g := o.target.encode(c, aa.param.Brightness)
+		current += ma
+		gain = math.Min(gain, g)
+		if err := o.client.sendMsg(fmt.Sprint(value)); err != nil {
+			aa.metrics.udpError()
+			aa.log.Warn("sending the colour failed", "output", o.target.Name, "err", err)
 		}
 	}
-	log.Println("The input device is:  ", inpDev.Name)
+	aa.metrics.frame(fftTime, time.Since(aa.u.readTime), time.Since(chunkStart) > aa.u.framePeriod, gain, current)
 
-	// Creating parameters
-	p := portaudio.LowLatencyParameters(inpDev, outDev)
-	p.FramesPerBuffer = len(buffer)
-	var sampleRate = p.SampleRate
-	var maxInfo = sampleRate / 2
-	aa.u.fBinSize = int(maxInfo / aa.param.bufferLengthUseful)
+	// Recording the spectrum alongside the frequency and colour it produced
+	if aa.lg.spec != nil {
+		aa.lg.spec.add(aa.u.bfft[:int(aa.u.bufferLengthUseful)], *aa.u.f, colour)
+	}
+
+	// Publishing the results for snapshots
+	aa.mu.Lock()
+	aa.status = analyserStatus{frequency: *aa.u.f, colour: colour}
+	aa.mu.Unlock()
+}
+
+// Sends black to every output so the lights are turned off when the
+// analysis ends
+func (aa *AudioAnalyser) blackout() {
+	for _, o := range aa.outputs {
+		if err := o.client.sendMsg(fmt.Sprint(uint32(0))); err != nil {
+			aa.log.Warn("turning off the output failed", "output", o.target.Name, "err", err)
+		}
+	}
+}
+
+// An audio stream from an input device which each Read fills the buffer it
+// was opened with from
+type audioStream interface {
+	Start() error
+	Read() error
+	Stop() error
+	Close() error
+}
 
-	// Create the stream
-	stream, err := portaudio.OpenStream(p, buffer)
-	chk(err)
+// Opens a stream from the input device whose name starts with device, empty
+// for the default device, reading into buffer. The stream is returned with
+// the name of the device and its sample rate
+type openInputFunc func(device string, buffer []float32) (audioStream, string, float64, error)
+
+// A portaudio stream, portaudio is initialised while the stream is open
+type portaudioStream struct {
+	*portaudio.Stream
+}
+
+// Closes the stream and terminates portaudio
+func (s portaudioStream) Close() error {
+	err := s.Stream.Close()
+	portaudio.Terminate()
+	return err
+}
+
+// Opens a stream from a portaudio input device
+func openPortaudio(device string, buffer []float32) (audioStream, string, float64, error) {
+	if err := portaudio.Initialize(); err != nil {
+		return nil, "", 0, fmt.Errorf("initialising portaudio: %w", err)
+	}
+
+	stream, name, sampleRate, err := func() (audioStream, string, float64, error) {
+		// Get the input device
+		host, devices, err := inputDevices()
+		if err != nil {
+			return nil, "", 0, fmt.Errorf("listing audio devices: %w", err)
+		}
+
+		var inpDev, outDev *portaudio.DeviceInfo
+		if device == "" {
+			inpDev = host.DefaultInputDevice
+		}
+		for _, d := range devices {
+			if device != "" && strings.HasPrefix(d.Name, device) {
+				inpDev = d
+			}
+		}
+		if inpDev == nil {
+			return nil, "", 0, fmt.Errorf("%w: no input device starting with %q", ErrDeviceNotFound, device)
+		}
+
+		// Creating parameters
+		p := portaudio.LowLatencyParameters(inpDev, outDev)
+		p.FramesPerBuffer = len(buffer)
+
+		// Create the stream
+		stream, err := portaudio.OpenStream(p, buffer)
+		if err != nil {
+			return nil, "", 0, fmt.Errorf("opening the stream from %q: %w", inpDev.Name, err)
+		}
+		return portaudioStream{stream}, inpDev.Name, p.SampleRate, nil
+	}()
+
+	if err != nil {
+		portaudio.Terminate()
+		return nil, "", 0, err
+	}
+	return stream, name, sampleRate, nil
+}
+
+// Opens a stream from the configured input device and prepares the analyser
+// for the stream's sample rate. The stream is started when no error is
+// returned
+func (aa *AudioAnalyser) openStream(buffer []float32) (audioStream, *analysisInput, error) {
+	stream, name, sampleRate, err := aa.openInput(aa.u.inputDeviceName, buffer)
+	if err != nil {
+		return nil, nil, err
+	}
+	aa.log.Info("opened the input device", "device", name)
+
+	aa.u.sampleRate = sampleRate
+	aa.mu.Lock()
+	aa.streamRate = sampleRate
+	aa.streamParams = aa.param
+	aa.mu.Unlock()
+
+	// The input stage converts the stream to the rate which is analysed
+	input := newAnalysisInput(sampleRate, aa.param.SampleRate, aa.param.Decimation, aa.param.BufferLength)
+	var maxInfo = input.rate / 2
+	aa.u.fBinSize = maxInfo / aa.u.bufferLengthUseful
+	if aa.u.fBinSize < minBinSize {
+		stream.Close()
+		return nil, nil, fmt.Errorf("the %g Hz stream from %q decimated by %d leaves bins of %.3g Hz, under %g Hz", sampleRate, name, aa.param.Decimation, aa.u.fBinSize, float64(minBinSize))
+	}
+	aa.u.tempo.reset(input.frameRate())
+	aa.u.framePeriod = time.Duration(float64(time.Second) / input.frameRate())
 
 	// Starting the stream
-	chk(stream.Start())
-	defer stream.Close()
+	if err := stream.Start(); err != nil {
+		stream.Close()
+		return nil, nil, fmt.Errorf("starting the stream from %q: %w", name, err)
+	}
+
+	return stream, input, nil
+}
+
+// Begins analysing audio from an audio stream. The stream is opened before
+// Start returns and any error doing so is returned, the analysis then runs
+// in its own goroutine until ctx is cancelled or Stop is called
+func (aa *AudioAnalyser) Start(ctx context.Context) error {
+	// The runtime config is taken when the analyser starts so any changes
+	// made while it was stopped are applied
+	aa.mu.Lock()
+	if aa.isRunning {
+		aa.mu.Unlock()
+		return ErrAlreadyRunning
+	}
+	aa.isRunning = true
+	cfg := aa.cfg.copy()
+	aa.dirty = false
+
+	// The loop's context and done channel are set before the stream is opened
+	// so a Stop during Start cancels the new run
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	aa.cancel = cancel
+	aa.done = done
+	aa.runErr = nil
+	aa.mu.Unlock()
+
+	stream, input, err := aa.start(cfg)
+	if err != nil {
+		cancel()
+		aa.mu.Lock()
+		aa.isRunning = false
+		aa.streamRate = 0
+		aa.runErr = err
+		aa.cancel = nil
+		aa.mu.Unlock()
+		close(done)
+		return err
+	}
+
+	go aa.run(ctx, stream, input, done)
+	return nil
+}
+
+// Prepares the analyser with the runtime config and opens the audio stream
+func (aa *AudioAnalyser) start(cfg runtimeConfig) (audioStream, *analysisInput, error) {
+	// Check the gradient still exists if one was chosen by name
+	if cfg.gradName != "" && cfg.gradName != "default" {
+		gt, err := GradientByName(cfg.gradName)
+		if err != nil {
+			return nil, nil, err
+		}
+		cfg.gradient = gt
+	}
+
+	aa.u.inputDeviceName = cfg.inputDevice
+	aa.u.creatSpec = cfg.spectrogram
+
+	// The parameters which shape the stream are fixed until the next start
+	aa.param = cfg.params
+	aa.u.bufferLengthUseful = float64(aa.param.BufferLength / 2)
+	aa.u.stft = fftsingle.STFTOptions{
+		Window: dspsingle.Rectangular(aa.param.BufferLength),
+		Hop:    aa.param.BufferLength,
+	}
+
+	aa.u.buffer = make([]float32, aa.param.BufferLength)
+	stream, input, err := aa.openStream(aa.u.buffer)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// Prepare variables for the stream
-	aa.u.farr = make([]int, aa.param.freqArrayL)
 	aa.u.c = new(int)
 	aa.u.old_freq = new(int)
 	aa.u.f = new(int)
+	if err := aa.applyConfig(cfg, true); err != nil {
+		aa.closeOutputs()
+		stream.Close()
+		return nil, nil, err
+	}
 
 	// Variables setup to record the data
 	aa.lg.freqLog = make([]int, 1)
 	aa.lg.dampLog = make([]int, 1)
 	aa.lg.smthLog = make([]int, 1)
+	if aa.u.creatSpec {
+		aa.lg.spec = newSpectrogramRecorder(aa.param.SpectrogramFrames, aa.u.fBinSize, input.frameRate())
+	}
 
-	// Variables to break the loop
-	var breakLoop bool = false
+	return stream, input, nil
+}
 
+// The analysis loop, reads the stream until ctx is cancelled or reading
+// fails. done is closed once the stream is closed and the logs are rendered
+func (aa *AudioAnalyser) run(ctx context.Context, stream audioStream, input *analysisInput, done chan struct{}) {
+	var err error
 	startTime := time.Now()
+	aa.u.startTime = startTime
+	aa.metrics.reset()
+	aa.log.Info("started the analysis", "sampleRate", input.rate)
+
 	// Start processing the stream
-	for {
-		chk(stream.Read())
-
-		// Perform the FFT on the buffer
-		aa.u.bfft = fftsingle.FFTReal(buffer)
-
-		// Get the index of the f with the largest magnitude
-		aa.u.index = aa.maxFreqInd()
-
-		// Calculate the new frequency
-		*aa.u.old_freq = *aa.u.f
-		aa.updateFreq()
-		log.Print("Frequency: ", *aa.u.f)
-		aa.lg.freqLog = append(aa.lg.freqLog, *aa.u.f)
-
-		// Dampening and Smoothing
-		if aa.param.smooth {
-			aa.smoothFreqs(aa.param.smoothA)
-			aa.smoothFreqs(0.3)
-			log.Print("Smoothed Frequency: ", *aa.u.f)
-			aa.lg.smthLog = append(aa.lg.smthLog, *aa.u.f)
-		}
-		if aa.param.damp {
-			aa.dampFreqs()
-			log.Print("Damped Frequency: ", *aa.u.f)
-			aa.lg.dampLog = append(aa.lg.dampLog, *aa.u.f)
+	for ctx.Err() == nil {
+		if err = stream.Read(); err == portaudio.InputOverflowed {
+			// Audio was lost but the buffer holds the latest audio, so the
+			// analysis carries on
+			aa.metrics.overflow()
+			aa.log.Debug("the audio stream overflowed")
+			err = nil
+		} else if err != nil {
+			err = fmt.Errorf("reading the audio stream: %w", err)
+			break
 		}
+		aa.u.readTime = time.Now()
 
-		// Calling the callback function with the colour value
-		aa.cb(aa.colourUINT32())
-
-		// Sending the value through the UDP stream
-		if aa.udph.shouldsend {
-			aa.udph.client.sendMsg(fmt.Sprint(aa.colourUINT32()))
+		// Apply any settings which changed during the last chunk
+		if cfg, ok := aa.takeConfig(); ok {
+			if cerr := aa.applyConfig(cfg, false); cerr != nil {
+				aa.log.Error("applying the analyser settings", "err", cerr)
+			}
 		}
 
-		// The analyser is stopped through the sig channel
-		select {
-		case <-aa.u.stopSig:
-			breakLoop = true
-		default:
+		// Filter out the frequencies which should not be visualised
+		if aa.u.prefilter != nil {
+			aa.u.prefilter.Process(aa.u.buffer)
 		}
 
-		if breakLoop {
-			break
-		}
+		// Analyse every chunk of audio the input stage produces
+		input.push(aa.u.buffer, aa.analyseChunk)
 	}
-	aa.u.isRunning = false
 	endTime := time.Now()
-	chk(stream.Stop())
-	if aa.param.creatVis {
+	aa.metrics.stop()
+
+	// The lights are turned off straight after the last frame was sent, so
+	// no frame can follow the black
+	aa.blackout()
+	aa.closeOutputs()
+
+	if serr := stream.Stop(); serr != nil && err == nil {
+		err = fmt.Errorf("stopping the audio stream: %w", serr)
+	}
+	stream.Close()
+
+	if aa.param.Graph {
 		names := []string{"Original F", "Smoothed F", "Damped F"}
 		// Start and end times are taken to find the elapsed time and scale the width of the graph generated
-		createGraph(names, endTime.Sub(startTime), &aa.lg.freqLog, &aa.lg.smthLog, &aa.lg.dampLog)
+		if gerr := createGraph(names, endTime.Sub(startTime), &aa.lg.freqLog, &aa.lg.smthLog, &aa.lg.dampLog); gerr != nil {
+			aa.log.Error("rendering the graph", "err", gerr)
+			if err == nil {
+				err = fmt.Errorf("rendering the graph: %w", gerr)
+			}
+		} else {
+			aa.log.Info("rendered the graph", "file", "output.png")
+		}
+	}
+	if aa.lg.spec != nil {
+		if serr := createSpectrogram(aa.lg.spec, "spectrogram.png"); serr != nil {
+			aa.log.Error("rendering the spectrogram", "err", serr)
+			if err == nil {
+				err = fmt.Errorf("rendering the spectrogram: %w", serr)
+			}
+		} else {
+			aa.log.Info("rendered the spectrogram", "file", "spectrogram.png")
+		}
+		aa.lg.spec = nil
+	}
+
+	if err != nil {
+		aa.log.Error("the analysis stopped", "err", err)
+	} else {
+		aa.log.Info("stopped the analysis", "duration", endTime.Sub(startTime).Round(time.Second))
+	}
+
+	aa.mu.Lock()
+	aa.isRunning = false
+	aa.streamRate = 0
+	aa.runErr = err
+	aa.cancel = nil
+	aa.mu.Unlock()
+	close(done)
+}
+
+// Returns the estimated tempo of the audio in beats per minute and the
+// position within the current beat in the range [0, 1). Both are 0 until
+// enough audio has been analysed to find a tempo
+func (aa *AudioAnalyser) Tempo() (bpm float64, phase float64) {
+	return aa.u.tempo.tempo()
+}
+
+// Stops analysis of the audio stream and waits for the analysis loop to
+// exit. It is safe to call Stop more than once or when the analyser is not
+// running. The error which ended the analysis, if any, is returned
+func (aa *AudioAnalyser) Stop() error {
+	aa.mu.Lock()
+	cancel := aa.cancel
+	aa.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
 	}
+	return aa.Wait()
 }
 
-// Stops analysis of the audio stream
-func (aa AudioAnalyser) StopAnalysis() {
-	if aa.u.isRunning {
-		aa.u.stopSig <- true
-		aa.u.isRunning = false
+// Waits for the analysis loop to exit and returns the error which ended it,
+// nil is returned straight away if the analyser has never been started
+func (aa *AudioAnalyser) Wait() error {
+	aa.mu.Lock()
+	done := aa.done
+	aa.mu.Unlock()
+
+	if done == nil {
+		return nil
 	}
+	<-done
+
+	aa.mu.Lock()
+	defer aa.mu.Unlock()
+	return aa.runErr
 }
 
-// Generates a new analyser object with default configuration
-func newAudioAnalyser(f func(uint32), g string) *AudioAnalyser {
-	return &AudioAnalyser{
-		param: &AudioAnalysisParams{
-			fCap:               2500,
-			usefulCap:          1200,
-			totalHue:           320,
-			fCapHue:            310,
-			bufferLength:       1024 * 2,
-			bufferLengthUseful: 1024,
-			freqArrayL:         4,
-			damp:               true,
-			smooth:             true,
-			smoothA:            0.73,
-			creatVis:           false,
-			gradName:           g,
-			inputDeviceName:    "Line 1",
-		},
-		u: &AudioAnalysisUnits{
-			stopSig: make(chan bool),
-		},
-		lg: &AudioAnalysisLogs{},
-		cb: f,
-		udph: &AudioAnalysisUDPHandler{
-			client:     newUdpC("6969"),
-			shouldsend: false,
-		},
+// Returns the input devices of the host api the analyser reads from.
+// MME is used when it is available, as every device is listed once under it
+// on windows, otherwise the default host api of the platform is used, e.g.
+// ALSA on linux. portaudio must be initialised
+func inputDevices() (*portaudio.HostApiInfo, []*portaudio.DeviceInfo, error) {
+	hosts, err := portaudio.HostApis()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var host *portaudio.HostApiInfo
+	for _, h := range hosts {
+		if h.Name == "MME" {
+			host = h
+		}
+	}
+	if host == nil {
+		host, err = portaudio.DefaultHostApi()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	devices := make([]*portaudio.DeviceInfo, 0)
+	for _, d := range host.Devices {
+		if d.MaxInputChannels > 0 {
+			devices = append(devices, d)
+		}
 	}
+
+	return host, devices, nil
 }
 
-// Get portaudio input devices available
-func getInputDevices() []string {
-	portaudio.Initialize()
+// Returns the names of the portaudio input devices available, any of which
+// can be passed to SetInputDevice. An empty name selects the default device
+func InputDevices() ([]string, error) {
+	if err := portaudio.Initialize(); err != nil {
+		return nil, err
+	}
 	defer portaudio.Terminate()
 
-	devices, err := portaudio.Devices()
-	chk(err)
+	_, devices, err := inputDevices()
+	if err != nil {
+		return nil, err
+	}
 
 	names := make([]string, 0)
 	for _, d := range devices {
-		if d.HostApi.Name == "MME" {
-			if d.MaxInputChannels > 0 {
-				names = append(names, d.Name)
-			}
-		}
+		names = append(names, d.Name)
 	}
 
-	return names
+	return names, nil
 }
@@ -0,0 +1,362 @@
+package lcv
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// An audio stream of a 440 Hz tone read in real time, standing in for an
+// input device
+type fakeStream struct {
+	// The buffer the stream was opened with
+	buffer []float32
+	// The error Read returns once failAfter chunks have been read, never if
+	// failAfter is 0
+	readErr   error
+	failAfter int
+	// Called when the stream is stopped, may be nil
+	onStop func()
+
+	mu                                   sync.Mutex
+	reads, starts, stops, closes, sample int
+}
+
+func (s *fakeStream) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.starts++
+	return nil
+}
+
+func (s *fakeStream) Read() error {
+	s.mu.Lock()
+	s.reads++
+	if s.failAfter > 0 && s.reads > s.failAfter {
+		s.mu.Unlock()
+		return s.readErr
+	}
+	for i := range s.buffer {
+		s.buffer[i] = float32(0.5 * math.Sin(2*math.Pi*440*float64(s.sample)/44100))
+		s.sample++
+	}
+	s.mu.Unlock()
+
+	time.Sleep(time.Millisecond)
+	return nil
+}
+
+func (s *fakeStream) Stop() error {
+	s.mu.Lock()
+	s.stops++
+	onStop := s.onStop
+	s.mu.Unlock()
+
+	if onStop != nil {
+		onStop()
+	}
+	return nil
+}
+
+func (s *fakeStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closes++
+	return nil
+}
+
+// Returns how many times the stream was started, stopped and closed
+func (s *fakeStream) counts() (starts, stops, closes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.starts, s.stops, s.closes
+}
+
+// An analyser reading from fake streams, which counts the frames it
+// publishes
+type fakeAnalyser struct {
+	*AudioAnalyser
+	// The streams the analyser has opened, in order
+	streams []*fakeStream
+	// Prepares each stream before it is opened, may be nil
+	prepare func(s *fakeStream)
+	// The error opening a stream returns, nil to open it
+	openErr error
+	frames  int64
+}
+
+func newFakeAnalyser(t *testing.T) *fakeAnalyser {
+	t.Helper()
+	fa := &fakeAnalyser{}
+	aa, err := New(WithLogger(nil), WithFrameCallback(func(Frame) {
+		atomic.AddInt64(&fa.frames, 1)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aa.openInput = func(device string, buffer []float32) (audioStream, string, float64, error) {
+		if fa.openErr != nil {
+			return nil, "", 0, fa.openErr
+		}
+		s := &fakeStream{buffer: buffer}
+		if fa.prepare != nil {
+			fa.prepare(s)
+		}
+		fa.streams = append(fa.streams, s)
+		return s, "fake", 44100, nil
+	}
+	fa.AudioAnalyser = aa
+	return fa
+}
+
+// Waits until the analyser has published n more frames
+func (fa *fakeAnalyser) waitFrames(t *testing.T, n int64) {
+	t.Helper()
+	target := atomic.LoadInt64(&fa.frames) + n
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&fa.frames) < target {
+		if time.Now().After(deadline) {
+			t.Fatalf("published %d frames, waited for %d", atomic.LoadInt64(&fa.frames), target)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Checks every stream was started, stopped and closed once
+func checkStreamsClosed(t *testing.T, streams []*fakeStream) {
+	t.Helper()
+	for i, s := range streams {
+		if starts, stops, closes := s.counts(); starts != 1 || stops != 1 || closes != 1 {
+			t.Errorf("stream %d was started %d, stopped %d and closed %d times, want once each", i, starts, stops, closes)
+		}
+	}
+}
+
+func TestStopBeforeStart(t *testing.T) {
+	fa := newFakeAnalyser(t)
+	if err := fa.Stop(); err != nil {
+		t.Errorf("stopping an analyser which never started returned %v", err)
+	}
+	if err := fa.Wait(); err != nil {
+		t.Errorf("waiting for an analyser which never started returned %v", err)
+	}
+	if fa.Snapshot().Running {
+		t.Error("an analyser which never started is running")
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	fa := newFakeAnalyser(t)
+
+	for run := 0; run < 3; run++ {
+		if err := fa.Start(context.Background()); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		if err := fa.Start(context.Background()); err != ErrAlreadyRunning {
+			t.Errorf("run %d: starting a running analyser returned %v, want ErrAlreadyRunning", run, err)
+		}
+		fa.waitFrames(t, 5)
+		if !fa.Snapshot().Running {
+			t.Errorf("run %d: the analyser is not running", run)
+		}
+
+		// Stop can be called again once the analyser has stopped
+		for i := 0; i < 3; i++ {
+			if err := fa.Stop(); err != nil {
+				t.Errorf("run %d: stop %d returned %v", run, i, err)
+			}
+		}
+		if fa.Snapshot().Running {
+			t.Errorf("run %d: the analyser is running after Stop", run)
+		}
+	}
+
+	if len(fa.streams) != 3 {
+		t.Errorf("opened %d streams, want one for each start", len(fa.streams))
+	}
+	checkStreamsClosed(t, fa.streams)
+}
+
+func TestCancelContext(t *testing.T) {
+	fa := newFakeAnalyser(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := fa.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	fa.waitFrames(t, 5)
+
+	cancel()
+	if err := fa.Wait(); err != nil {
+		t.Errorf("a cancelled analyser returned %v", err)
+	}
+	if fa.Snapshot().Running {
+		t.Error("the analyser is running after its context was cancelled")
+	}
+	checkStreamsClosed(t, fa.streams)
+}
+
+func TestRunError(t *testing.T) {
+	unplugged := errors.New("unplugged")
+	fa := newFakeAnalyser(t)
+	fa.prepare = func(s *fakeStream) {
+		s.readErr, s.failAfter = unplugged, 10
+	}
+	if err := fa.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The error which ended the run is returned by Wait and Stop until the
+	// analyser is started again
+	if err := fa.Wait(); !errors.Is(err, unplugged) {
+		t.Errorf("Wait returned %v, want the read error", err)
+	}
+	if err := fa.Stop(); !errors.Is(err, unplugged) {
+		t.Errorf("Stop returned %v, want the read error", err)
+	}
+	if fa.Snapshot().Running {
+		t.Error("the analyser is running after reading failed")
+	}
+	checkStreamsClosed(t, fa.streams)
+
+	fa.prepare = nil
+	if err := fa.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := fa.Stop(); err != nil {
+		t.Errorf("a run after a failed one returned %v", err)
+	}
+}
+
+func TestOpenError(t *testing.T) {
+	fa := newFakeAnalyser(t)
+	fa.openErr = ErrDeviceNotFound
+	if err := fa.Start(context.Background()); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Start returned %v, want ErrDeviceNotFound", err)
+	}
+	if err := fa.Wait(); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Wait returned %v, want ErrDeviceNotFound", err)
+	}
+	if fa.Snapshot().Running {
+		t.Error("the analyser is running after its stream failed to open")
+	}
+
+	fa.openErr = nil
+	if err := fa.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := fa.Stop(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBlackoutAfterLastFrame(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Reads the colours the output has been sent so far
+	var received []string
+	drain := func() {
+		buffer := make([]byte, 64)
+		for {
+			conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			n, _, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			received = append(received, strings.TrimSpace(string(buffer[:n])))
+		}
+	}
+
+	fa := newFakeAnalyser(t)
+	// The colours sent before the stream is stopped must end with the black
+	var atStop []string
+	fa.prepare = func(s *fakeStream) {
+		s.onStop = func() {
+			drain()
+			atStop = append([]string(nil), received...)
+		}
+	}
+	cfg := DefaultConfig()
+	cfg.Outputs = []OutputTarget{{Name: "test", Address: conn.LocalAddr().String(), Enabled: true}}
+	if err := fa.ApplyConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fa.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	fa.waitFrames(t, 5)
+	if err := fa.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	drain()
+
+	if len(atStop) < 2 || atStop[len(atStop)-1] != "0" {
+		t.Fatalf("when the stream stopped the output had received %q, want colours ending in black", atStop)
+	}
+	if len(received) != len(atStop) {
+		t.Errorf("the output received %q after the black", received[len(atStop):])
+	}
+}
+
+func TestInputBand(t *testing.T) {
+	// Returns the rms level of a tone at f after the filters have settled
+	level := func(filter FilterParams, f float64) float64 {
+		aa := &AudioAnalyser{u: &analysisUnits{filter: filter}}
+		prefilter := aa.newPrefilter(44100)
+		var sum float64
+		for chunk := 0; chunk < 10; chunk++ {
+			x := make([]float32, 2048)
+			for i := range x {
+				x[i] = float32(math.Sin(2 * math.Pi * f * float64(chunk*len(x)+i) / 44100))
+			}
+			if prefilter != nil {
+				prefilter.Process(x)
+			}
+			if chunk == 9 {
+				for _, v := range x {
+					sum += float64(v) * float64(v)
+				}
+				sum /= float64(len(x))
+			}
+		}
+		return math.Sqrt(sum)
+	}
+
+	tests := []struct {
+		name   string
+		filter FilterParams
+		passed []float64
+		cut    []float64
+	}{
+		{"no band", FilterParams{}, []float64{40, 800, 10000}, nil},
+		{"band", FilterParams{BandLowF: 200, BandHighF: 2000}, []float64{600, 700}, []float64{20, 40, 10000, 16000}},
+		{"low band", FilterParams{BandHighF: 200}, []float64{40, 60}, []float64{2000, 10000}},
+		{"high band", FilterParams{BandLowF: 2000}, []float64{8000, 12000}, []float64{100, 200}},
+		{"band with the hum notched", FilterParams{HumF: 50, BandHighF: 200}, []float64{80}, []float64{50, 2000}},
+	}
+
+	// A tone in the middle of its band keeps most of its level, one several
+	// octaves out of it is cut by more than 40 dB
+	for _, tt := range tests {
+		for _, f := range tt.passed {
+			if l := level(tt.filter, f); l < 0.5 {
+				t.Errorf("%s: %g Hz passed at %g", tt.name, f, l)
+			}
+		}
+		for _, f := range tt.cut {
+			if l := level(tt.filter, f); l > 0.01*math.Sqrt(0.5) {
+				t.Errorf("%s: %g Hz passed at %g, want it cut", tt.name, f, l)
+			}
+		}
+	}
+}
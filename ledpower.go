@@ -0,0 +1,92 @@
+package lcv
+
+import (
+	"fmt"
+	"math"
+)
+
+// The current one channel of one led draws at full level when none is set,
+// typical of the WS2812 and SK6812
+const defaultChannelMilliamps = 20
+
+// A model of the current an output's leds draw, used to dim the colours
+// sent to it so the supply is never overloaded
+type PowerBudget struct {
+	// The number of leds the output drives with the colour
+	LEDs int `json:"leds"`
+	// The current one channel of one led draws at full level in mA, 20 if
+	// it is 0
+	ChannelMilliamps float64 `json:"channelMilliamps,omitempty"`
+	// The current one led draws when it is off in mA
+	IdleMilliamps float64 `json:"idleMilliamps,omitempty"`
+	// The most current the supply can give the leds in mA, the colours are
+	// dimmed to stay within it. 0 does not limit the colours, the current
+	// is only estimated
+	SupplyMilliamps float64 `json:"supplyMilliamps,omitempty"`
+}
+
+// Returns a description of each problem with the power budget
+func (p *PowerBudget) problems(prefix string) []string {
+	var problems []string
+	add := func(field, format string, args ...interface{}) {
+		problems = append(problems, prefix+field+": "+fmt.Sprintf(format, args...))
+	}
+
+	if p.LEDs < 1 {
+		add("leds", "must be at least 1, got %d", p.LEDs)
+	}
+	if p.ChannelMilliamps < 0 {
+		add("channelMilliamps", "must not be negative, got %g", p.ChannelMilliamps)
+	}
+	if p.IdleMilliamps < 0 {
+		add("idleMilliamps", "must not be negative, got %g", p.IdleMilliamps)
+	}
+	if p.SupplyMilliamps < 0 {
+		add("supplyMilliamps", "must not be negative, got %g", p.SupplyMilliamps)
+	} else if p.SupplyMilliamps > 0 && p.SupplyMilliamps <= p.idle() {
+		add("supplyMilliamps", "must be more than the %g mA the leds draw when they are off, got %g", p.idle(), p.SupplyMilliamps)
+	}
+
+	return problems
+}
+
+// Returns the current the leds draw when they are off in mA
+func (p *PowerBudget) idle() float64 {
+	return float64(p.LEDs) * p.IdleMilliamps
+}
+
+// Returns the current the leds draw showing a colour in mA, 0 for an output
+// with no power budget
+func (p *PowerBudget) current(c RGBW) float64 {
+	if p == nil {
+		return 0
+	}
+	perChannel := p.ChannelMilliamps
+	if perChannel == 0 {
+		perChannel = defaultChannelMilliamps
+	}
+	return p.idle() + float64(p.LEDs)*perChannel*(c.R+c.G+c.B+c.W)
+}
+
+// Returns the factor the levels of a colour drawing current mA must be
+// scaled by to stay within the supply, 1 if they are within it
+func (p *PowerBudget) limit(current float64) float64 {
+	if p == nil || p.SupplyMilliamps == 0 || current <= p.SupplyMilliamps {
+		return 1
+	}
+	return (p.SupplyMilliamps - p.idle()) / (current - p.idle())
+}
+
+// Returns the colour with every level scaled by a factor
+func (c RGBW) scale(f float64) RGBW {
+	return RGBW{R: c.R * f, G: c.G * f, B: c.B * f, W: c.W * f}
+}
+
+// Returns the colour with every level rounded down to the 255 steps of the
+// value sent to an output
+func (c RGBW) floor() RGBW {
+	step := func(v float64) float64 {
+		return math.Floor(v*255.0) / 255.0
+	}
+	return RGBW{R: step(c.R), G: step(c.G), B: step(c.B), W: step(c.W)}
+}
@@ -0,0 +1,130 @@
+package lcv
+
+import (
+	"github.com/lucasb-eyer/go-colorful"
+	"math"
+	"testing"
+)
+
+func TestPowerCurrent(t *testing.T) {
+	tests := []struct {
+		name string
+		p    *PowerBudget
+		c    RGBW
+		want float64
+	}{
+		{"no budget", nil, RGBW{R: 1, G: 1, B: 1}, 0},
+		{"off", &PowerBudget{LEDs: 10, IdleMilliamps: 1}, RGBW{}, 10},
+		{"default channel", &PowerBudget{LEDs: 10}, RGBW{R: 1}, 200},
+		{"white", &PowerBudget{LEDs: 10, IdleMilliamps: 1}, RGBW{R: 1, G: 1, B: 1}, 610},
+		{"rgbw", &PowerBudget{LEDs: 2, ChannelMilliamps: 15}, RGBW{R: 0.5, W: 1}, 45},
+	}
+
+	for _, tt := range tests {
+		if got := tt.p.current(tt.c); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: drew %g mA, want %g", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPowerLimit(t *testing.T) {
+	p := &PowerBudget{LEDs: 100, IdleMilliamps: 1, SupplyMilliamps: 3100}
+	tests := []struct {
+		name    string
+		p       *PowerBudget
+		current float64
+		want    float64
+	}{
+		{"no budget", nil, 1e6, 1},
+		{"no supply", &PowerBudget{LEDs: 100}, 1e6, 1},
+		{"within", p, 3000, 1},
+		{"at the supply", p, 3100, 1},
+		// Only the current above the idle current is scaled
+		{"over", p, 6100, 0.5},
+		{"far over", p, 30100, 0.1},
+	}
+
+	for _, tt := range tests {
+		if got := tt.p.limit(tt.current); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: %g mA scaled by %g, want %g", tt.name, tt.current, got, tt.want)
+		}
+	}
+
+	// Scaling by the limit brings the current to the supply
+	c := RGBW{R: 1, G: 1, B: 1}
+	if got := p.current(c.scale(p.limit(p.current(c)))); math.Abs(got-p.SupplyMilliamps) > 1e-9 {
+		t.Errorf("limited white drew %g mA, want %g", got, p.SupplyMilliamps)
+	}
+}
+
+func TestPowerProblems(t *testing.T) {
+	tests := []struct {
+		name string
+		p    PowerBudget
+		ok   bool
+	}{
+		{"valid", PowerBudget{LEDs: 300, IdleMilliamps: 1, SupplyMilliamps: 9000}, true},
+		{"estimate only", PowerBudget{LEDs: 300}, true},
+		{"no leds", PowerBudget{}, false},
+		{"negative channel", PowerBudget{LEDs: 1, ChannelMilliamps: -1}, false},
+		{"negative idle", PowerBudget{LEDs: 1, IdleMilliamps: -1}, false},
+		{"negative supply", PowerBudget{LEDs: 1, SupplyMilliamps: -1}, false},
+		// A supply which cannot power the leds when they are off cannot be
+		// met by dimming them
+		{"supply at idle", PowerBudget{LEDs: 100, IdleMilliamps: 1, SupplyMilliamps: 100}, false},
+		{"supply under idle", PowerBudget{LEDs: 100, IdleMilliamps: 1, SupplyMilliamps: 50}, false},
+	}
+
+	for _, tt := range tests {
+		if problems := tt.p.problems(""); (len(problems) == 0) != tt.ok {
+			t.Errorf("%s: got problems %q, want ok %v", tt.name, problems, tt.ok)
+		}
+	}
+}
+
+// Returns the current the leds draw showing a value sent to an output
+func valueCurrent(p *PowerBudget, value uint32) float64 {
+	level := func(shift uint) float64 {
+		return float64(value>>shift&0xff) / 255
+	}
+	return p.current(RGBW{W: level(24), R: level(16), G: level(8), B: level(0)})
+}
+
+func TestPowerInEncode(t *testing.T) {
+	// 300 leds of #faf6cb draw about 16.4 A, more than a 10 A supply gives
+	col := MustParseHex("#faf6cb")
+	target := OutputTarget{Power: &PowerBudget{LEDs: 300, SupplyMilliamps: 10000}}
+
+	value, current, gain := target.encode(col, 1)
+	if sent := valueCurrent(target.Power, value); math.Abs(current-sent) > 1e-6 {
+		t.Errorf("reported %g mA, want the %g mA %#06x draws", current, sent, value)
+	}
+	if current > 10000 || current < 9900 {
+		t.Errorf("reported %g mA, want just under the 10000 mA supply", current)
+	}
+	if want := 10000 / (300 * 20 * (col.R + col.G + col.B)); math.Abs(gain-want) > 1e-9 {
+		t.Errorf("gain is %g, want %g", gain, want)
+	}
+
+	// The brightness dims the colour before the supply limits it, a colour
+	// within the supply is sent as it is
+	value, current, gain = target.encode(col, 0.5)
+	if value != 0x7d7b66 || gain != 0.5 {
+		t.Errorf("at half brightness got %#06x at gain %g, want 0x7d7b66 at gain 0.5", value, gain)
+	}
+	if want := 300 * 20 * 0.5 * (col.R + col.G + col.B); math.Abs(current-want) > 1e-6 {
+		t.Errorf("at half brightness reported %g mA, want %g", current, want)
+	}
+
+	// With a white channel the white leds draw current too, 300 at full
+	// level draw 6 A. Half of 255 rounds up to 128 which would draw a
+	// little over a 3 A supply, so the level is rounded down
+	target = OutputTarget{White: &WhiteChannel{}, Power: &PowerBudget{LEDs: 300, SupplyMilliamps: 3000}}
+	value, current, _ = target.encode(colorful.Color{R: 1, G: 1, B: 1}, 1)
+	if value != 0x7f000000 {
+		t.Errorf("white got %#08x, want 0x7f000000", value)
+	}
+	if sent := valueCurrent(target.Power, value); math.Abs(current-sent) > 1e-6 || sent > 3000 {
+		t.Errorf("reported %g mA and %#08x draws %g mA, want both within the 3000 mA supply", current, value, sent)
+	}
+}
@@ -0,0 +1,132 @@
+package lcv
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Returned when no preset has the requested name
+var ErrPresetNotFound = errors.New("preset not found")
+
+// The name of the directory the visualiser keeps its files in, inside the
+// user's config directory
+const configDirName = "led-colour-visualiser"
+
+// Returns the directory the visualiser keeps its files in for the current
+// user, e.g. ~/.config/led-colour-visualiser on linux
+func ConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, configDirName), nil
+}
+
+// Returns the directory presets are stored in unless another is chosen
+func DefaultPresetDir() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "presets"), nil
+}
+
+// Stores named configs as json files in a directory, one file per preset
+// named after it
+type PresetStore struct {
+	// The directory holding the preset files
+	dir string
+}
+
+// Generates a preset store for a directory, which is created when the
+// first preset is saved
+func NewPresetStore(dir string) *PresetStore {
+	return &PresetStore{dir: dir}
+}
+
+// Returns the directory the presets are stored in
+func (s *PresetStore) Dir() string {
+	return s.dir
+}
+
+// Returns the file a preset is stored in, names which could refer to a file
+// outside the directory are rejected
+func (s *PresetStore) path(name string) (string, error) {
+	if name == "" || strings.TrimSpace(name) != name {
+		return "", fmt.Errorf("invalid preset name %q: must not be empty or start or end with spaces", name)
+	}
+	if strings.ContainsAny(name, `/\:`) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid preset name %q: must not contain / \\ : or start with .", name)
+	}
+	return filepath.Join(s.dir, name+".json"), nil
+}
+
+// Returns the names of the stored presets in alphabetical order, there are
+// none if the directory does not exist
+func (s *PresetStore) Names() ([]string, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		if !f.IsDir() && filepath.Ext(f.Name()) == ".json" {
+			names = append(names, strings.TrimSuffix(f.Name(), ".json"))
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Reads and validates a preset
+func (s *PresetStore) Load(name string) (Config, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return Config{}, err
+	}
+
+	c, err := LoadConfig(path)
+	if os.IsNotExist(err) {
+		return Config{}, fmt.Errorf("%w: %q", ErrPresetNotFound, name)
+	}
+	return c, err
+}
+
+// Validates and stores a preset, replacing any preset with the same name
+func (s *PresetStore) Save(name string, c Config) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	return c.Save(path)
+}
+
+// Removes a preset
+func (s *PresetStore) Delete(name string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %q", ErrPresetNotFound, name)
+	}
+	return err
+}
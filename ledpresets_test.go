@@ -0,0 +1,119 @@
+package lcv
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPresetStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "presets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The directory is created by the first save
+	s := NewPresetStore(filepath.Join(dir, "presets"))
+	if names, err := s.Names(); err != nil || len(names) != 0 {
+		t.Fatalf("a missing directory has the presets %q, %v", names, err)
+	}
+
+	party := DefaultConfig()
+	party.Gradient = "starboy"
+	party.Filter.Damp = false
+	party.Params.Brightness = 0.6
+	party.Outputs = []OutputTarget{{Name: "shelf", Address: "192.168.1.21:6969", Enabled: true, White: &WhiteChannel{Mode: WhiteTemperature, Temperature: 3000}}}
+	calm := DefaultConfig()
+	calm.Curve = &FrequencyCurve{Points: []CurvePoint{{40, 0}, {2500, 1}}, Interpolation: CurveLog}
+
+	for name, c := range map[string]Config{"house party": party, "calm": calm} {
+		if err := s.Save(name, c); err != nil {
+			t.Fatalf("saving %q: %v", name, err)
+		}
+	}
+	for name, want := range map[string]Config{"house party": party, "calm": calm} {
+		got, err := s.Load(name)
+		if err != nil {
+			t.Fatalf("loading %q: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q loaded as %+v, want %+v", name, got, want)
+		}
+	}
+
+	// Files which are not presets are not listed
+	if err := ioutil.WriteFile(filepath.Join(s.Dir(), "notes.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if names, err := s.Names(); err != nil || !reflect.DeepEqual(names, []string{"calm", "house party"}) {
+		t.Errorf("the presets are %q, %v, want calm and house party", names, err)
+	}
+
+	// Saving under a name replaces the preset
+	calm.Params.Brightness = 0.3
+	if err := s.Save("calm", calm); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Load("calm"); err != nil || got.Params.Brightness != 0.3 {
+		t.Errorf("the replaced preset has a brightness of %g, %v, want 0.3", got.Params.Brightness, err)
+	}
+
+	// An invalid config is not saved
+	bad := DefaultConfig()
+	bad.Params.Brightness = 2
+	if err := s.Save("bad", bad); err == nil {
+		t.Error("saved an invalid config")
+	}
+
+	if err := s.Delete("calm"); err != nil {
+		t.Fatal(err)
+	}
+	if names, err := s.Names(); err != nil || !reflect.DeepEqual(names, []string{"house party"}) {
+		t.Errorf("after deleting calm the presets are %q, %v", names, err)
+	}
+	if _, err := s.Load("calm"); !errors.Is(err, ErrPresetNotFound) {
+		t.Errorf("loading a deleted preset returned %v, want ErrPresetNotFound", err)
+	}
+	if err := s.Delete("calm"); !errors.Is(err, ErrPresetNotFound) {
+		t.Errorf("deleting a deleted preset returned %v, want ErrPresetNotFound", err)
+	}
+}
+
+func TestPresetNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "presets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := NewPresetStore(dir)
+
+	// Names which are empty or could refer to a file outside the directory
+	// are rejected by every method
+	for _, name := range []string{"", " ", " padded", "padded ", "../x", "a/b", `a\b`, "c:x", ".hidden", ".."} {
+		if err := s.Save(name, DefaultConfig()); err == nil {
+			t.Errorf("saved a preset named %q", name)
+		}
+		if _, err := s.Load(name); err == nil || errors.Is(err, ErrPresetNotFound) {
+			t.Errorf("loading a preset named %q returned %v, want an invalid name", name, err)
+		}
+		if err := s.Delete(name); err == nil || errors.Is(err, ErrPresetNotFound) {
+			t.Errorf("deleting a preset named %q returned %v, want an invalid name", name, err)
+		}
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("invalid names left %d files", len(files))
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "x.json")); err == nil {
+		t.Error("a preset was saved outside the directory")
+	}
+
+	for _, name := range []string{"x", "house party", "Ünïcode", "a.b"} {
+		if err := s.Save(name, DefaultConfig()); err != nil {
+			t.Errorf("saving a preset named %q: %v", name, err)
+		}
+	}
+}
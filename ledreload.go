@@ -0,0 +1,179 @@
+package lcv
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// How often the reloader checks its files for changes unless another
+// interval is set
+const defaultReloadInterval = time.Second
+
+// The modification time and size of a file, a change to either means the
+// file has been written
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watches a config file and a gradient directory by polling them, and
+// applies any change to a running analyser. An invalid config file is
+// reported and the analyser keeps its previous config
+type Reloader struct {
+	// The config file applied to the analyser when it changes, not watched
+	// if empty
+	ConfigPath string
+	// The user gradient directory reloaded when any gradient in it changes,
+	// not watched if empty
+	GradientDir string
+	// How often the files are checked
+	Interval time.Duration
+	// Called with a config which has been read before it is applied, so
+	// settings which should not be reloaded can be kept. May be nil
+	Adjust func(c *Config)
+	// Called after the config file has been reloaded, err is set if the
+	// config was invalid and was not applied. May be nil
+	OnConfig func(err error)
+	// Called after the gradient directory has been reloaded, err lists any
+	// invalid gradients. May be nil
+	OnGradients func(err error)
+
+	analyser *AudioAnalyser
+	// The stamps of the files when they were last loaded
+	config    fileStamp
+	gradients map[string]fileStamp
+}
+
+// Generates a reloader which applies changes to the config file and the
+// gradient directory to the analyser. Either path may be empty
+func NewReloader(aa *AudioAnalyser, configPath, gradientDir string) *Reloader {
+	return &Reloader{
+		ConfigPath:  configPath,
+		GradientDir: gradientDir,
+		Interval:    defaultReloadInterval,
+		analyser:    aa,
+	}
+}
+
+// Returns the stamp of a file, the zero stamp if it does not exist
+func stampFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
+
+// Returns the stamps of the gradients in a directory by file name
+func stampGradientDir(dir string) map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	files, _ := ioutil.ReadDir(dir)
+	for _, f := range files {
+		if !f.IsDir() && filepath.Ext(f.Name()) == ".json" {
+			stamps[f.Name()] = fileStamp{modTime: f.ModTime(), size: f.Size()}
+		}
+	}
+	return stamps
+}
+
+// Reports whether two sets of gradient stamps differ
+func stampsChanged(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return true
+	}
+	for name, s := range a {
+		if t, ok := b[name]; !ok || t != s {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks the files until ctx is cancelled. The files as they are when Run
+// is called are taken to be loaded already
+func (r *Reloader) Run(ctx context.Context) {
+	if r.ConfigPath != "" {
+		r.config = stampFile(r.ConfigPath)
+	}
+	if r.GradientDir != "" {
+		r.gradients = stampGradientDir(r.GradientDir)
+	}
+
+	interval := r.Interval
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.check()
+		}
+	}
+}
+
+// Reloads whichever files have changed since they were last loaded. The
+// gradients are reloaded first so a config naming a new gradient can use it
+func (r *Reloader) check() {
+	if r.GradientDir != "" {
+		if stamps := stampGradientDir(r.GradientDir); stampsChanged(stamps, r.gradients) {
+			r.gradients = stamps
+			r.reloadGradients()
+		}
+	}
+
+	if r.ConfigPath != "" {
+		// A missing file is left alone, editors often replace a file by
+		// removing it and writing a new one
+		if stamp := stampFile(r.ConfigPath); stamp != r.config && stamp != (fileStamp{}) {
+			r.config = stamp
+			r.reloadConfig()
+		}
+	}
+}
+
+// Reloads the gradient directory. If the analyser uses a user gradient its
+// table is replaced by the reloaded one, so edits show on the next frame
+func (r *Reloader) reloadGradients() {
+	err := LoadGradientDir(r.GradientDir)
+
+	if name := r.analyser.Snapshot().GradientName; name != "" && name != "default" {
+		if _, ok := gradients[name]; !ok {
+			// A gradient which has been removed keeps being used until
+			// another is chosen
+			if gt, lerr := GradientByName(name); lerr == nil {
+				r.analyser.updateConfig(func(c *runtimeConfig) {
+					if c.gradName == name {
+						c.gradient = gt
+					}
+				})
+			}
+		}
+	}
+
+	if r.OnGradients != nil {
+		r.OnGradients(err)
+	}
+}
+
+// Reloads the config file and applies it to the analyser
+func (r *Reloader) reloadConfig() {
+	c, err := LoadConfig(r.ConfigPath)
+	if err == nil {
+		if r.Adjust != nil {
+			r.Adjust(&c)
+		}
+		err = r.analyser.ApplyConfig(c)
+	}
+
+	if r.OnConfig != nil {
+		r.OnConfig(err)
+	}
+}
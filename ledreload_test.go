@@ -0,0 +1,175 @@
+package lcv
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Writes a file with a modification time later than any written before, so
+// the reloader sees the change however coarse the file system's times are
+func writeStamped(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	stampedWrites++
+	mod := time.Now().Add(time.Duration(stampedWrites) * time.Minute)
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// The number of files written by writeStamped
+var stampedWrites int
+
+func TestReloaderConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	writeStamped(t, path, []byte(`{"gradient": "starboy"}`))
+
+	aa, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []error
+	r := NewReloader(aa, path, "")
+	r.OnConfig = func(err error) {
+		errs = append(errs, err)
+	}
+	r.config = stampFile(path)
+
+	// An unchanged file is not reloaded
+	r.check()
+	if len(errs) != 0 {
+		t.Fatalf("reloaded an unchanged config: %v", errs)
+	}
+
+	// An edit is applied, with the adjustment made first
+	r.Adjust = func(c *Config) {
+		c.Filter.DampLength = 3
+	}
+	writeStamped(t, path, []byte(`{"gradient": "starboy", "filter": {"damp": true, "dampLength": 9}}`))
+	r.check()
+	if len(errs) != 1 || errs[0] != nil {
+		t.Fatalf("applying an edit reported %v, want one nil error", errs)
+	}
+	s := aa.Snapshot()
+	if s.GradientName != "starboy" || s.Filter.DampLength != 3 {
+		t.Errorf("after an edit the gradient is %q and the damp length %d, want starboy and 3", s.GradientName, s.Filter.DampLength)
+	}
+
+	// An invalid edit is reported and the previous config stays
+	writeStamped(t, path, []byte(`{"gradient": "no such gradient"}`))
+	r.check()
+	writeStamped(t, path, []byte(`{"params": {"brightness": 2}}`))
+	r.check()
+	writeStamped(t, path, []byte(`{"gradient": `))
+	r.check()
+	if len(errs) != 4 || errs[1] == nil || errs[2] == nil || errs[3] == nil {
+		t.Fatalf("applying invalid edits reported %v, want an error for each", errs[1:])
+	}
+	if s := aa.Snapshot(); s.GradientName != "starboy" || s.Filter.DampLength != 3 || s.Params.Brightness != DefaultParams().Brightness {
+		t.Errorf("after invalid edits the gradient is %q, the damp length %d and the brightness %g, want the previous config", s.GradientName, s.Filter.DampLength, s.Params.Brightness)
+	}
+
+	// A removed file is left alone
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	r.check()
+	if len(errs) != 4 {
+		t.Errorf("a removed config was reloaded: %v", errs[4:])
+	}
+}
+
+func TestReloaderGradients(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer LoadGradientDir("")
+
+	path := filepath.Join(dir, "sunset.json")
+	writeStamped(t, path, []byte(`{"stops": [{"col": "#ff0000", "pos": 0}, {"col": "#0000ff", "pos": 1}]}`))
+	if err := LoadGradientDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	aa, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.Gradient = "sunset"
+	if err := aa.ApplyConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	var errs []error
+	r := NewReloader(aa, "", dir)
+	r.OnGradients = func(err error) {
+		errs = append(errs, err)
+	}
+	r.gradients = stampGradientDir(dir)
+
+	colour := func() string {
+		return aa.Snapshot().Gradient.Stops[0].Col.Hex()
+	}
+
+	// An added gradient can be chosen
+	writeStamped(t, filepath.Join(dir, "dawn.json"), []byte(`{"stops": [{"col": "#000000", "pos": 0}, {"col": "#ffffff", "pos": 1}]}`))
+	r.check()
+	if len(errs) != 1 || errs[0] != nil {
+		t.Fatalf("adding a gradient reported %v, want one nil error", errs)
+	}
+	if names := UserGradientNames(); len(names) != 2 || names[0] != "dawn" || names[1] != "sunset" {
+		t.Errorf("the user gradients are %q, want dawn and sunset", names)
+	}
+
+	// An edit to the gradient in use shows in the analyser
+	writeStamped(t, path, []byte(`{"stops": [{"col": "#00ff00", "pos": 0}, {"col": "#0000ff", "pos": 1}]}`))
+	r.check()
+	if len(errs) != 2 || errs[1] != nil {
+		t.Fatalf("editing a gradient reported %v, want a nil error", errs[1:])
+	}
+	if got := colour(); got != "#00ff00" {
+		t.Errorf("after an edit the gradient starts at %s, want #00ff00", got)
+	}
+
+	// An invalid edit is reported and the previous version is kept
+	writeStamped(t, path, []byte(`{"stops": [{"col": "#ffff00", "pos": 0}]}`))
+	r.check()
+	if len(errs) != 3 || errs[2] == nil {
+		t.Fatalf("an invalid edit reported %v, want an error", errs[2:])
+	}
+	if gt, err := GradientByName("sunset"); err != nil || gt.Stops[0].Col.Hex() != "#00ff00" {
+		t.Errorf("after an invalid edit sunset is %v, %v, want the previous version", gt, err)
+	}
+	if got := colour(); got != "#00ff00" {
+		t.Errorf("after an invalid edit the gradient starts at %s, want #00ff00", got)
+	}
+
+	// A removed gradient can no longer be chosen, but the analyser keeps
+	// using it until another is
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	r.check()
+	if len(errs) != 4 || errs[3] != nil {
+		t.Fatalf("removing a gradient reported %v, want a nil error", errs[3:])
+	}
+	if _, err := GradientByName("sunset"); err == nil {
+		t.Error("a removed gradient can still be chosen")
+	}
+	if s := aa.Snapshot(); s.GradientName != "sunset" || colour() != "#00ff00" {
+		t.Errorf("after removing its gradient the analyser uses %q starting at %s", s.GradientName, colour())
+	}
+}
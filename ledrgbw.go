@@ -0,0 +1,120 @@
+package lcv
+
+import (
+	"fmt"
+	"github.com/lucasb-eyer/go-colorful"
+	"math"
+)
+
+// A colour for leds with a white channel such as the SK6812, each channel
+// is a level in the range [0, 1]
+type RGBW struct {
+	R, G, B, W float64
+}
+
+// Converts the colour to a uint32 value of the form 0xWWRRGGBB, the packing
+// used by the NeoPixel libraries. With no white it is the same as the value
+// of the RGB colour
+func (c RGBW) UINT32() uint32 {
+	channel := func(v float64) uint32 {
+		return uint32(math.Max(0, math.Min(1, v))*255.0 + 0.5)
+	}
+	return channel(c.W)<<24 | channel(c.R)<<16 | channel(c.G)<<8 | channel(c.B)
+}
+
+// How the level of the white leds is taken out of a colour
+type WhiteMode string
+
+const (
+	// Moves the part of the colour which all three leds share to the white
+	// leds, assuming the white leds are the same white as the three together
+	WhiteMin WhiteMode = "min"
+	// Moves as much of the colour as the white leds can show to them, using
+	// the colour temperature of the white leds so warm or cool white leds do
+	// not tint the colour
+	WhiteTemperature WhiteMode = "temperature"
+)
+
+// The colour temperature of the white leds when none is set, that of the
+// neutral white SK6812
+const defaultWhiteTemperature = 4500
+
+// Settings for an output whose leds have a white channel. Four channels are
+// sent for each colour instead of three, see RGBW.UINT32
+type WhiteChannel struct {
+	// How the white level is taken out of the colour, "min" if it is empty
+	Mode WhiteMode `json:"mode,omitempty"`
+	// The colour temperature of the white leds in kelvin, 4500 if it is 0.
+	// Only used by the temperature mode
+	Temperature float64 `json:"temperature,omitempty"`
+}
+
+// Returns a description of each problem with the white channel settings
+func (w *WhiteChannel) problems(prefix string) []string {
+	var problems []string
+	switch w.Mode {
+	case "", WhiteMin, WhiteTemperature:
+	default:
+		problems = append(problems, fmt.Sprintf("%smode: must be min or temperature, got %q", prefix, w.Mode))
+	}
+	if w.Temperature != 0 && (w.Temperature < 1000 || w.Temperature > 40000) {
+		problems = append(problems, fmt.Sprintf("%stemperature: must be 0 or in the range [1000, 40000] kelvin, got %g", prefix, w.Temperature))
+	}
+	return problems
+}
+
+// Splits the levels of a colour between the red, green, blue and white leds
+func (w *WhiteChannel) split(c colorful.Color) RGBW {
+	white := colorful.Color{R: 1, G: 1, B: 1}
+	if w.Mode == WhiteTemperature {
+		t := w.Temperature
+		if t == 0 {
+			t = defaultWhiteTemperature
+		}
+		white = kelvinColour(t)
+	}
+
+	// The white level is as much of the white led's colour as fits in the
+	// colour, the rest is left to the coloured leds
+	level := math.Inf(1)
+	for _, p := range [][2]float64{{c.R, white.R}, {c.G, white.G}, {c.B, white.B}} {
+		if p[1] > 0 {
+			level = math.Min(level, p[0]/p[1])
+		}
+	}
+	level = math.Max(0, math.Min(1, level))
+
+	return RGBW{
+		R: c.R - level*white.R,
+		G: c.G - level*white.G,
+		B: c.B - level*white.B,
+		W: level,
+	}
+}
+
+// Returns the colour of a black body at a temperature in kelvin, scaled so
+// its brightest channel is 1. It uses Tanner Helland's fit, which is close
+// enough for the colour of white leds
+func kelvinColour(kelvin float64) colorful.Color {
+	t := kelvin / 100
+	var r, g, b float64
+	if t <= 66 {
+		r = 255
+		g = 99.4708025861*math.Log(t) - 161.1195681661
+	} else {
+		r = 329.698727446 * math.Pow(t-60, -0.1332047592)
+		g = 288.1221695283 * math.Pow(t-60, -0.0755148492)
+	}
+	switch {
+	case t >= 66:
+		b = 255
+	case t <= 19:
+		b = 0
+	default:
+		b = 138.5177312231*math.Log(t-10) - 305.0447927307
+	}
+
+	c := colorful.Color{R: r / 255, G: g / 255, B: b / 255}.Clamped()
+	max := math.Max(c.R, math.Max(c.G, c.B))
+	return colorful.Color{R: c.R / max, G: c.G / max, B: c.B / max}
+}
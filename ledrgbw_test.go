@@ -0,0 +1,109 @@
+package lcv
+
+import (
+	"github.com/lucasb-eyer/go-colorful"
+	"math"
+	"testing"
+)
+
+func TestRGBWPacking(t *testing.T) {
+	tests := []struct {
+		c    RGBW
+		want uint32
+	}{
+		{RGBW{}, 0x00000000},
+		{RGBW{W: 1}, 0xff000000},
+		{RGBW{R: 1}, 0x00ff0000},
+		{RGBW{G: 1}, 0x0000ff00},
+		{RGBW{B: 1}, 0x000000ff},
+		{RGBW{R: 0x12 / 255.0, G: 0x34 / 255.0, B: 0x56 / 255.0, W: 0x78 / 255.0}, 0x78123456},
+		// Levels out of range are clamped rather than spilling into the
+		// next channel
+		{RGBW{R: 1.5, G: -0.5, B: 2, W: -1}, 0x00ff00ff},
+	}
+
+	for _, tt := range tests {
+		if got := tt.c.UINT32(); got != tt.want {
+			t.Errorf("%+v packed as %#08x, want %#08x", tt.c, got, tt.want)
+		}
+	}
+
+	// Without white the value is the RGB colour's
+	col := MustParseHex("#faf6cb")
+	if got, want := (RGBW{R: col.R, G: col.G, B: col.B}).UINT32(), ColourUINT32(col); got != want {
+		t.Errorf("RGB colour packed as %#08x, want %#06x", got, want)
+	}
+}
+
+func closeRGBW(a, b RGBW, tolerance float64) bool {
+	return math.Abs(a.R-b.R) < tolerance && math.Abs(a.G-b.G) < tolerance &&
+		math.Abs(a.B-b.B) < tolerance && math.Abs(a.W-b.W) < tolerance
+}
+
+func TestWhiteMin(t *testing.T) {
+	w := &WhiteChannel{}
+	tests := []struct {
+		in   colorful.Color
+		want RGBW
+	}{
+		{colorful.Color{R: 0.5, G: 0.5, B: 0.5}, RGBW{W: 0.5}},
+		{colorful.Color{R: 1, G: 1, B: 1}, RGBW{W: 1}},
+		{colorful.Color{R: 1}, RGBW{R: 1}},
+		{colorful.Color{G: 1}, RGBW{G: 1}},
+		{colorful.Color{B: 1}, RGBW{B: 1}},
+		{colorful.Color{R: 0.8, G: 0.5, B: 0.2}, RGBW{R: 0.6, G: 0.3, W: 0.2}},
+		{colorful.Color{}, RGBW{}},
+	}
+
+	for _, tt := range tests {
+		if got := w.split(tt.in); !closeRGBW(got, tt.want, 1e-9) {
+			t.Errorf("%v split as %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWhiteTemperature(t *testing.T) {
+	for _, kelvin := range []float64{2700, 4500, 6500} {
+		w := &WhiteChannel{Mode: WhiteTemperature, Temperature: kelvin}
+		white := kelvinColour(kelvin)
+
+		// The colour of the white leds at any level is all white
+		for _, level := range []float64{0.25, 1} {
+			in := colorful.Color{R: white.R * level, G: white.G * level, B: white.B * level}
+			if got := w.split(in); !closeRGBW(got, RGBW{W: level}, 1e-9) {
+				t.Errorf("%g K: its own white at %g split as %+v, want all white", kelvin, level, got)
+			}
+		}
+
+		// A primary has no white in it
+		if got := w.split(colorful.Color{B: 1}); got.W != 0 {
+			t.Errorf("%g K: blue split as %+v, want no white", kelvin, got)
+		}
+
+		// The leds together show the colour which was split
+		in := colorful.Color{R: 0.9, G: 0.7, B: 0.6}
+		got := w.split(in)
+		back := colorful.Color{R: got.R + got.W*white.R, G: got.G + got.W*white.G, B: got.B + got.W*white.B}
+		if !closeColour(back, in) || got.R < 0 || got.G < 0 || got.B < 0 {
+			t.Errorf("%g K: %v split as %+v which shows %v", kelvin, in, got, back)
+		}
+	}
+
+	// Warm white leds are warmer than cool ones, and the brightest channel
+	// is always 1
+	warm, cool := kelvinColour(2700), kelvinColour(6500)
+	if !(warm.B < cool.B && warm.R >= cool.R) {
+		t.Errorf("2700 K is %v and 6500 K is %v, want the first warmer", warm, cool)
+	}
+	for _, k := range []float64{1000, 2700, 4500, 6600, 10000, 40000} {
+		c := kelvinColour(k)
+		if max := math.Max(c.R, math.Max(c.G, c.B)); math.Abs(max-1) > 1e-9 {
+			t.Errorf("%g K is %v, want its brightest channel at 1", k, c)
+		}
+	}
+
+	// The default temperature is used when none is set
+	if a, b := (&WhiteChannel{Mode: WhiteTemperature}).split(MustParseHex("#faf6cb")), (&WhiteChannel{Mode: WhiteTemperature, Temperature: defaultWhiteTemperature}).split(MustParseHex("#faf6cb")); a != b {
+		t.Errorf("no temperature split as %+v, want %+v", a, b)
+	}
+}
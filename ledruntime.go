@@ -0,0 +1,466 @@
+package lcv
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lucasb-eyer/go-colorful"
+	"net"
+	"strings"
+)
+
+// Settings for the filtering of the audio and of the detected frequency
+type FilterParams struct {
+	// Whether to enable smoothing
+	Smooth bool `json:"smooth"`
+	// Smoothing alpha in the range [0, 1], the larger alpha the more the old
+	// frequency is weighted
+	SmoothAlpha float64 `json:"smoothAlpha"`
+	// Whether to enable damping
+	Damp bool `json:"damp"`
+	// The number of past frequencies averaged when damping
+	DampLength int `json:"dampLength"`
+	// The cutoff of the high-pass filter applied to the input before analysis,
+	// 0 disables the filter
+	HighPassF float64 `json:"highPassF"`
+	// The frequency of the mains hum notched out of the input along with its
+	// harmonics, 0 disables the notches
+	HumF float64 `json:"humF"`
+	// The crossovers the input is split into bands at before analysis, only
+	// the band between them is analysed. 0 leaves that side of the band
+	// open, so the whole input is analysed when both are 0
+	BandLowF  float64 `json:"bandLowF,omitempty"`
+	BandHighF float64 `json:"bandHighF,omitempty"`
+}
+
+// Settings for a destination the colours are sent to
+type OutputTarget struct {
+	// The name of the target shown to the user
+	Name string `json:"name"`
+	// The host and port of the udp receiver, e.g. "127.0.0.1:6969"
+	Address string `json:"address"`
+	// Whether colours are sent to the target
+	Enabled bool `json:"enabled"`
+	// The colour correction of the leds, nil sends the colours unchanged
+	Calibration *Calibration `json:"calibration,omitempty"`
+	// The white channel of RGBW leds, nil for RGB leds
+	White *WhiteChannel `json:"white,omitempty"`
+	// The current the leds draw and the supply they share, nil if the
+	// current is neither estimated nor limited
+	Power *PowerBudget `json:"power,omitempty"`
+}
+
+// Converts a colour to the value sent to the target, of the form 0xRRGGBB
+// or 0xWWRRGGBB if the target has a white channel. The levels are scaled by
+// brightness and then dimmed further if they would overload the target's
+// supply. The estimated current in mA and the overall scale applied to the
+// levels are returned with the value
+func (t OutputTarget) encode(col colorful.Color, brightness float64) (value uint32, current float64, gain float64) {
+	levels := t.Calibration.levels(col)
+	c := RGBW{R: levels.R, G: levels.G, B: levels.B}
+	if t.White != nil {
+		c = t.White.split(levels)
+	}
+
+	c = c.scale(brightness)
+	current = t.Power.current(c)
+	if limit := t.Power.limit(current); limit < 1 {
+		// Rounded down so the leds never draw more than the supply
+		c = c.scale(limit).floor()
+		current = t.Power.current(c)
+		brightness *= limit
+	}
+
+	// Without white the value is the same as the RGB colour's
+	return c.UINT32(), current, brightness
+}
+
+// A copy of the analyser's settings and latest results at a point in time
+type AnalyserSnapshot struct {
+	// Whether the analyser is running
+	Running bool
+	// The parameters of the analyser. While the audio stream is open the
+	// parameters which shape it are those it was opened with, a change to
+	// them shows once the analyser has stopped, see SetParams
+	Params Params
+	// The name of the selected gradient, empty if a custom gradient or the
+	// default hue colouring is used
+	GradientName string
+	// The gradient used to colour the audio, nil for the default hue colouring
+	Gradient *GradientTable
+	// The curve mapping the frequency to a position in the gradient, nil if
+	// the gradient's curve or the parameters are used
+	Curve *FrequencyCurve
+	// The filter settings
+	Filter FilterParams
+	// The destinations the colours are sent to
+	Outputs []OutputTarget
+	// The start of the name of the input device used when the analyser starts
+	InputDevice string
+	// Whether a spectrogram is created when the analyser stops
+	Spectrogram bool
+	// The frequency calculated for the latest audio chunk
+	Frequency int
+	// The colour calculated for the latest audio chunk
+	Colour uint32
+	// The estimated tempo in beats per minute and the position within the
+	// current beat, see Tempo
+	BPM       float64
+	BeatPhase float64
+}
+
+// The settings which can be changed while the analyser is running, they are
+// applied by the analysis loop between audio chunks
+type runtimeConfig struct {
+	params      Params
+	gradName    string
+	gradient    *GradientTable
+	curve       *FrequencyCurve
+	filter      FilterParams
+	outputs     []OutputTarget
+	inputDevice string
+	spectrogram bool
+}
+
+// Returns a copy of the config which shares no slices or calibrations with
+// the original
+func (c runtimeConfig) copy() runtimeConfig {
+	c.outputs = append([]OutputTarget(nil), c.outputs...)
+	for i := range c.outputs {
+		c.outputs[i].Calibration = c.outputs[i].Calibration.clone()
+		if w := c.outputs[i].White; w != nil {
+			wc := *w
+			c.outputs[i].White = &wc
+		}
+		if p := c.outputs[i].Power; p != nil {
+			pc := *p
+			c.outputs[i].Power = &pc
+		}
+	}
+	return c
+}
+
+// The latest results of the analysis loop
+type analyserStatus struct {
+	frequency int
+	colour    uint32
+}
+
+// Updates the runtime config under the lock and marks it to be applied
+// before the next audio chunk
+func (aa *AudioAnalyser) updateConfig(f func(c *runtimeConfig)) {
+	aa.mu.Lock()
+	defer aa.mu.Unlock()
+
+	f(&aa.cfg)
+	aa.dirty = true
+}
+
+// Returns a copy of the runtime config if it has changed since it was last
+// taken, this is called by the analysis loop
+func (aa *AudioAnalyser) takeConfig() (runtimeConfig, bool) {
+	aa.mu.Lock()
+	defer aa.mu.Unlock()
+
+	if !aa.dirty {
+		return runtimeConfig{}, false
+	}
+	aa.dirty = false
+	return aa.cfg.copy(), true
+}
+
+// Sets the gradient used to colour the audio, nil switches to the default
+// hue colouring. A normalised copy of the table is used, so its keypoints can
+// be in any order and it can be modified after it is set
+func (aa *AudioAnalyser) SetGradient(gt *GradientTable) {
+	if gt != nil {
+		gt = gt.normalised()
+	}
+	aa.updateConfig(func(c *runtimeConfig) {
+		c.gradName = ""
+		c.gradient = gt
+	})
+}
+
+// Sets the gradient used to colour the audio by name, "default" or an empty
+// name switches to the default hue colouring
+func (aa *AudioAnalyser) SetGradientName(name string) error {
+	var gt *GradientTable
+	if name != "" && name != "default" {
+		var err error
+		gt, err = GradientByName(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	aa.updateConfig(func(c *runtimeConfig) {
+		c.gradName = name
+		c.gradient = gt
+	})
+	return nil
+}
+
+// Sets the curve mapping the frequency to a position in the gradient, or to
+// a hue for the default colouring, from the next audio chunk. It takes the
+// place of the gradient's curve and of the colour mapping parameters. nil
+// removes the curve. The curve must not be modified after it is set
+func (aa *AudioAnalyser) SetCurve(c *FrequencyCurve) error {
+	if c != nil {
+		if problems := curveProblems("curve", c); len(problems) > 0 {
+			return errors.New(strings.Join(problems, "; "))
+		}
+	}
+
+	aa.updateConfig(func(rc *runtimeConfig) {
+		rc.curve = c
+	})
+	return nil
+}
+
+// Sets the parameters of the analyser. The colour mapping, Graph and
+// Brightness take effect from the next audio chunk, BufferLength,
+// SampleRate, Decimation and SpectrogramFrames shape the audio stream so
+// they only take effect when the analyser is next started. Until then
+// Snapshot and Config report the values the stream was opened with
+func (aa *AudioAnalyser) SetParams(p Params) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+
+	aa.updateConfig(func(c *runtimeConfig) {
+		c.params = p
+	})
+	return nil
+}
+
+// Applies every setting of a config at once, so a running analyser switches
+// between two chunks of audio. The stream is not restarted, so the input
+// device and the settings which shape the stream only change when the
+// analyser is next started, see SetParams
+func (aa *AudioAnalyser) ApplyConfig(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	// The filters must also suit the stream which is open
+	aa.mu.Lock()
+	streamRate := aa.streamRate
+	aa.mu.Unlock()
+	if problems := cfg.Filter.problems("filter.", streamRate); len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+
+	var gradName string
+	var gt *GradientTable
+	if cfg.CustomGradient != nil {
+		gt = cfg.CustomGradient.normalised()
+	} else {
+		gradName = cfg.Gradient
+		if gradName != "" && gradName != "default" {
+			var err error
+			if gt, err = GradientByName(gradName); err != nil {
+				return err
+			}
+		}
+	}
+
+	aa.updateConfig(func(c *runtimeConfig) {
+		c.params = cfg.Params
+		c.gradName = gradName
+		c.gradient = gt
+		c.curve = cfg.Curve
+		c.filter = cfg.Filter
+		c.outputs = append([]OutputTarget(nil), cfg.Outputs...)
+		c.inputDevice = cfg.InputDevice
+		c.spectrogram = cfg.Spectrogram
+	})
+	return nil
+}
+
+// Sets the smoothing, damping and input filter settings. An error is
+// returned and nothing is changed if a setting is invalid, or if an input
+// filter is not below the Nyquist frequency of the sample rate or of the
+// open stream
+func (aa *AudioAnalyser) SetFilterParams(p FilterParams) error {
+	aa.mu.Lock()
+	sampleRate, streamRate := aa.cfg.params.SampleRate, aa.streamRate
+	aa.mu.Unlock()
+	if problems := p.problems("filter.", sampleRate, streamRate); len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+
+	aa.updateConfig(func(c *runtimeConfig) {
+		c.filter = p
+	})
+	return nil
+}
+
+// Sets the destinations the colours are sent to, targets with the same
+// address as a current target keep their connection. An error is returned
+// and nothing is changed if an address is invalid
+func (aa *AudioAnalyser) SetOutputs(targets []OutputTarget) error {
+	for _, t := range targets {
+		if _, err := net.ResolveUDPAddr("udp4", t.Address); err != nil {
+			return fmt.Errorf("output %q: %w", t.Name, err)
+		}
+		var problems []string
+		if t.Calibration != nil {
+			problems = append(problems, t.Calibration.problems("calibration.")...)
+		}
+		if t.White != nil {
+			problems = append(problems, t.White.problems("white.")...)
+		}
+		if t.Power != nil {
+			problems = append(problems, t.Power.problems("power.")...)
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("output %q: %s", t.Name, strings.Join(problems, "; "))
+		}
+	}
+
+	aa.updateConfig(func(c *runtimeConfig) {
+		c.outputs = append([]OutputTarget(nil), targets...)
+	})
+	return nil
+}
+
+// Sets the start of the name of the input device, the device is only
+// changed when the analyser is next started
+func (aa *AudioAnalyser) SetInputDevice(name string) {
+	aa.updateConfig(func(c *runtimeConfig) {
+		c.inputDevice = name
+	})
+}
+
+// Sets whether a spectrogram is created when the analyser stops, this only
+// takes effect when the analyser is next started
+func (aa *AudioAnalyser) SetSpectrogram(enabled bool) {
+	aa.updateConfig(func(c *runtimeConfig) {
+		c.spectrogram = enabled
+	})
+}
+
+// Returns a copy of the analyser's current settings and latest results
+func (aa *AudioAnalyser) Snapshot() AnalyserSnapshot {
+	bpm, phase := aa.Tempo()
+
+	aa.mu.Lock()
+	defer aa.mu.Unlock()
+
+	c := aa.cfg.copy()
+	params := c.params
+	if aa.streamRate != 0 {
+		params.BufferLength = aa.streamParams.BufferLength
+		params.SampleRate = aa.streamParams.SampleRate
+		params.Decimation = aa.streamParams.Decimation
+		params.SpectrogramFrames = aa.streamParams.SpectrogramFrames
+	}
+	return AnalyserSnapshot{
+		Running:      aa.isRunning,
+		Params:       params,
+		GradientName: c.gradName,
+		Gradient:     c.gradient,
+		Curve:        c.curve,
+		Filter:       c.filter,
+		Outputs:      c.outputs,
+		InputDevice:  c.inputDevice,
+		Spectrogram:  c.spectrogram,
+		Frequency:    aa.status.frequency,
+		Colour:       aa.status.colour,
+		BPM:          bpm,
+		BeatPhase:    phase,
+	}
+}
+
+// Applies the runtime config to the analysis loop. It is only called from
+// the analysis goroutine between audio chunks, so a change never affects
+// part of a chunk. When init is set everything is rebuilt. Targets which
+// fail to connect are left out and their errors returned
+func (aa *AudioAnalyser) applyConfig(c runtimeConfig, init bool) error {
+	// The colour mapping can change between chunks, the parameters which
+	// shape the stream are only taken when the analyser starts
+	if init {
+		aa.param = c.params
+	} else {
+		aa.param.FCap = c.params.FCap
+		aa.param.UsefulCap = c.params.UsefulCap
+		aa.param.TotalHue = c.params.TotalHue
+		aa.param.FCapHue = c.params.FCapHue
+		aa.param.Graph = c.params.Graph
+		aa.param.Brightness = c.params.Brightness
+	}
+
+	aa.u.aaGT = c.gradient
+	aa.u.curve = c.curve
+	aa.u.gtUsed = c.gradient != nil
+
+	// The filters run at the rate of the stream, which the settings could
+	// not be checked against before it was opened. Filters the stream cannot
+	// take are refused and the previous filters are kept
+	var errs []string
+	filter := c.filter
+	if problems := filter.problems("filter.", aa.u.sampleRate); len(problems) > 0 {
+		if init {
+			return fmt.Errorf("the filters do not suit the %g Hz stream: %s", aa.u.sampleRate, strings.Join(problems, "; "))
+		}
+		errs = append(errs, fmt.Sprintf("keeping the previous filters as they do not suit the %g Hz stream: %s", aa.u.sampleRate, strings.Join(problems, "; ")))
+		filter = aa.u.filter
+	}
+
+	old := aa.u.filter
+	aa.u.filter = filter
+	if init || filter.DampLength != len(aa.u.farr) {
+		aa.u.farr = make([]int, filter.DampLength)
+		*aa.u.c = 0
+	}
+	if init || filter.HighPassF != old.HighPassF || filter.HumF != old.HumF || filter.BandLowF != old.BandLowF || filter.BandHighF != old.BandHighF {
+		aa.u.prefilter = aa.newPrefilter(aa.u.sampleRate)
+	}
+
+	// Targets which are still enabled keep their client, the rest are closed
+	var outputs []*output
+	for _, t := range c.outputs {
+		if !t.Enabled {
+			continue
+		}
+
+		var o *output
+		for i, old := range aa.outputs {
+			if old != nil && old.target.Address == t.Address {
+				o = old
+				aa.outputs[i] = nil
+				break
+			}
+		}
+		if o == nil {
+			client, err := newUdpCAddress(t.Address)
+			if err == nil {
+				err = client.start()
+			}
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("connecting to %s: %v", t.Name, err))
+				continue
+			}
+			o = &output{client: client}
+			aa.log.Info("connected the output", "output", t.Name, "address", t.Address)
+		}
+		o.target = t
+		outputs = append(outputs, o)
+	}
+	aa.closeOutputs()
+	aa.outputs = outputs
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Closes the clients of every output
+func (aa *AudioAnalyser) closeOutputs() {
+	for _, o := range aa.outputs {
+		if o != nil {
+			o.client.closeConnection()
+		}
+	}
+	aa.outputs = nil
+}
@@ -0,0 +1,126 @@
+package lcv
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestRuntimeAPIWhileRunning(t *testing.T) {
+	fa := newFakeAnalyser(t)
+	if err := fa.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	fa.waitFrames(t, 5)
+
+	// Every setter races the analysis loop and the other setters, run with
+	// -race to check they share nothing unguarded
+	var wg sync.WaitGroup
+	run := func(f func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				f(i)
+			}
+		}()
+	}
+	run(func(i int) {
+		p := DefaultParams()
+		p.FCap = 2000 + float64(i)
+		if err := fa.SetParams(p); err != nil {
+			t.Error(err)
+		}
+	})
+	run(func(i int) {
+		f := DefaultFilterParams()
+		f.DampLength = 1 + i%5
+		if err := fa.SetFilterParams(f); err != nil {
+			t.Error(err)
+		}
+	})
+	run(func(i int) {
+		names := []string{"starboy", "default"}
+		if err := fa.SetGradientName(names[i%2]); err != nil {
+			t.Error(err)
+		}
+		fa.SetGradient(&GradientTable{Stops: []GradientStop{{Col: MustParseHex("#ff0000")}, {Col: MustParseHex("#0000ff"), Pos: 1}}})
+		if err := fa.SetCurve(&FrequencyCurve{Points: []CurvePoint{{40, 0}, {2500, 1}}, Interpolation: CurveSpline}); err != nil {
+			t.Error(err)
+		}
+	})
+	run(func(i int) {
+		if err := fa.SetOutputs([]OutputTarget{{Name: "off", Address: "127.0.0.1:6969"}}); err != nil {
+			t.Error(err)
+		}
+		fa.SetInputDevice("fake")
+		fa.SetSpectrogram(false)
+	})
+	run(func(i int) {
+		cfg := DefaultConfig()
+		cfg.Params.Brightness = 0.5
+		if err := fa.ApplyConfig(cfg); err != nil {
+			t.Error(err)
+		}
+	})
+	run(func(i int) {
+		s := fa.Snapshot()
+		if !s.Running || s.Params.BufferLength != DefaultParams().BufferLength {
+			t.Errorf("snapshot %d is running %v with a buffer of %d", i, s.Running, s.Params.BufferLength)
+		}
+		fa.Config()
+		fa.Tempo()
+	})
+	wg.Wait()
+	fa.waitFrames(t, 5)
+
+	if err := fa.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamParamsWaitForStart(t *testing.T) {
+	fa := newFakeAnalyser(t)
+	if err := fa.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	fa.waitFrames(t, 1)
+
+	// The colour mapping changes straight away, the buffer waits for the
+	// next start and the snapshot shows the buffer in use until then
+	p := DefaultParams()
+	p.FCap = 2000
+	p.BufferLength = 4096
+	p.SpectrogramFrames = 10
+	if err := fa.SetParams(p); err != nil {
+		t.Fatal(err)
+	}
+	fa.waitFrames(t, 2)
+	if got := fa.Snapshot().Params; got.FCap != 2000 || got.BufferLength != DefaultParams().BufferLength || got.SpectrogramFrames != DefaultParams().SpectrogramFrames {
+		t.Errorf("while running the fCap is %g, the buffer %d and the spectrogram frames %d, want 2000, %d and %d", got.FCap, got.BufferLength, got.SpectrogramFrames, DefaultParams().BufferLength, DefaultParams().SpectrogramFrames)
+	}
+	if got := fa.Config().Params.BufferLength; got != DefaultParams().BufferLength {
+		t.Errorf("while running the config has a buffer of %d, want %d", got, DefaultParams().BufferLength)
+	}
+	if got := len(fa.streams[0].buffer); got != DefaultParams().BufferLength {
+		t.Errorf("the stream reads %d samples, want %d", got, DefaultParams().BufferLength)
+	}
+
+	if err := fa.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fa.Snapshot().Params; got != p {
+		t.Errorf("once stopped the params are %+v, want %+v", got, p)
+	}
+
+	if err := fa.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	fa.waitFrames(t, 1)
+	if got := fa.Snapshot().Params; got != p || len(fa.streams[1].buffer) != 4096 {
+		t.Errorf("after starting again the params are %+v reading %d samples, want %+v", got, len(fa.streams[1].buffer), p)
+	}
+	if err := fa.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
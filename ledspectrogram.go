@@ -0,0 +1,256 @@
+package lcv
+
+import (
+	"fmt"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/cmplx"
+	"os"
+)
+
+const (
+	// Height in pixels of the frequency axis of the spectrogram
+	spectrogramHeight = 512
+	// Height in pixels of the output colour strip under the spectrogram
+	spectrogramStripHeight = 24
+	// Space in pixels left for the frequency labels and time labels
+	spectrogramMarginLeft   = 56
+	spectrogramMarginBottom = 20
+	// The quietest level shown in the spectrogram, relative to the loudest
+	spectrogramRangeDB = 80
+	// The lowest frequency on the log frequency axis
+	spectrogramMinFreq = 20
+)
+
+// Colours used to map the spectrogram levels from quiet to loud
+var spectrogramPalette = &GradientTable{Stops: []GradientStop{
+	{Col: MustParseHex("#000004"), Pos: 0.0},
+	{Col: MustParseHex("#51127c"), Pos: 0.3},
+	{Col: MustParseHex("#b73779"), Pos: 0.55},
+	{Col: MustParseHex("#fc8961"), Pos: 0.8},
+	{Col: MustParseHex("#fcfdbf"), Pos: 1.0},
+}}
+
+// Records the magnitude spectrum, detected frequency and output colour of
+// each audio chunk. Only the most recent maxFrames chunks are kept so the
+// memory used by a long session is bounded
+type spectrogramRecorder struct {
+	// The maximum number of audio chunks which are stored
+	maxFrames int
+	// The difference in frequency between each bin of the spectra in Hz
+	fBinSize float64
+	// The number of audio chunks recorded per second
+	frameRate float64
+	// Ring buffers holding the magnitude spectrum, the frequency and the
+	// colour of each audio chunk
+	spectra [][]float32
+	freqs   []int
+	colours []uint32
+	// Counter for the ring buffers, works the same as the counter used for
+	// damping
+	c int
+	// The number of audio chunks recorded, capped at maxFrames
+	filled int
+	// The number of audio chunks recorded since the recorder was created,
+	// including those which have been discarded
+	total int
+}
+
+// Generates a new spectrogram recorder which keeps the last maxFrames audio
+// chunks of a stream with the given bin size and chunk rate
+func newSpectrogramRecorder(maxFrames int, fBinSize float64, frameRate float64) *spectrogramRecorder {
+	return &spectrogramRecorder{
+		maxFrames: maxFrames,
+		fBinSize:  fBinSize,
+		frameRate: frameRate,
+		spectra:   make([][]float32, maxFrames),
+		freqs:     make([]int, maxFrames),
+		colours:   make([]uint32, maxFrames),
+	}
+}
+
+// Records the useful half of the spectrum of an audio chunk along with the
+// frequency and colour the analyser calculated from it. The spectra are the
+// rows of the analyser's STFT, so the recording is a spectrogram of the input
+func (s *spectrogramRecorder) add(spectrum []complex64, f int, colour uint32) {
+	// The slice of the oldest chunk is reused once the ring buffer is full
+	mag := s.spectra[s.c]
+	if len(mag) != len(spectrum) {
+		mag = make([]float32, len(spectrum))
+	}
+	for i, v := range spectrum {
+		mag[i] = float32(cmplx.Abs(complex128(v)))
+	}
+
+	s.spectra[s.c] = mag
+	s.freqs[s.c] = f
+	s.colours[s.c] = colour
+	s.c = (s.c + 1) % s.maxFrames
+	if s.filled < s.maxFrames {
+		s.filled++
+	}
+	s.total++
+}
+
+// Returns the index in the ring buffers of the i-th oldest recorded chunk
+func (s *spectrogramRecorder) index(i int) int {
+	return (s.c - s.filled + i + s.maxFrames) % s.maxFrames
+}
+
+// Returns the times in seconds from the start of the recording of the
+// oldest chunk which is kept and of the end of the latest chunk
+func (s *spectrogramRecorder) timeRange() (start, end float64) {
+	return float64(s.total-s.filled) / s.frameRate, float64(s.total) / s.frameRate
+}
+
+// Converts a frequency to a row of the spectrogram, the rows are spaced
+// logarithmically between spectrogramMinFreq and maxFreq
+func spectrogramRow(f, maxFreq float64) int {
+	pos := math.Log(f/spectrogramMinFreq) / math.Log(maxFreq/spectrogramMinFreq)
+	return int(float64(spectrogramHeight-1) * (1 - pos))
+}
+
+// Renders the recorded chunks as a spectrogram with a log frequency axis, with
+// the detected frequency traced over it and the output colours along the
+// bottom. One column of pixels is drawn for each chunk
+func (s *spectrogramRecorder) render() *image.RGBA {
+	if s.filled == 0 {
+		return nil
+	}
+
+	bins := len(s.spectra[s.index(0)])
+	maxFreq := s.fBinSize * float64(bins)
+
+	width := spectrogramMarginLeft + s.filled
+	height := spectrogramHeight + spectrogramStripHeight + spectrogramMarginBottom
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+
+	// The levels are shown relative to the loudest bin of the recording
+	var peak float32
+	for i := 0; i < s.filled; i++ {
+		for _, v := range s.spectra[s.index(i)] {
+			if v > peak {
+				peak = v
+			}
+		}
+	}
+	if peak == 0 {
+		peak = 1
+	}
+
+	// Precompute the fractional bin each row of the log frequency axis samples
+	rowBin := make([]float64, spectrogramHeight)
+	for y := range rowBin {
+		pos := 1 - float64(y)/float64(spectrogramHeight-1)
+		f := spectrogramMinFreq * math.Pow(maxFreq/spectrogramMinFreq, pos)
+		rowBin[y] = f / s.fBinSize
+	}
+
+	for i := 0; i < s.filled; i++ {
+		x := spectrogramMarginLeft + i
+		mag := s.spectra[s.index(i)]
+
+		for y, b := range rowBin {
+			// Linearly interpolate between the bins either side of the row
+			j := int(b)
+			var v float64
+			if j >= len(mag)-1 {
+				v = float64(mag[len(mag)-1])
+			} else {
+				frac := b - float64(j)
+				v = float64(mag[j])*(1-frac) + float64(mag[j+1])*frac
+			}
+
+			db := 20 * math.Log10(v/float64(peak)+1e-12)
+			level := 1 + db/spectrogramRangeDB
+			if level < 0 {
+				level = 0
+			}
+			r, g, bl := spectrogramPalette.GetInterpolatedColorFor(level).RGB255()
+			img.SetRGBA(x, y, color.RGBA{r, g, bl, 0xff})
+		}
+
+		// The detected frequency is traced in white over the spectrum
+		if f := float64(s.freqs[s.index(i)]); f >= spectrogramMinFreq {
+			y := spectrogramRow(f, maxFreq)
+			for dy := -1; dy <= 1; dy++ {
+				if y+dy >= 0 && y+dy < spectrogramHeight {
+					img.SetRGBA(x, y+dy, color.RGBA{0xff, 0xff, 0xff, 0xff})
+				}
+			}
+		}
+
+		// The colour strip shows the colour which was output for the chunk
+		c := s.colours[s.index(i)]
+		col := color.RGBA{uint8(c >> 16), uint8(c >> 8), uint8(c), 0xff}
+		for y := spectrogramHeight; y < spectrogramHeight+spectrogramStripHeight; y++ {
+			img.SetRGBA(x, y, col)
+		}
+	}
+
+	// Frequency axis ticks and labels at each decade and its halfway point
+	black := color.RGBA{0, 0, 0, 0xff}
+	for _, f := range []float64{20, 50, 100, 200, 500, 1000, 2000, 5000, 10000, 20000} {
+		if f > maxFreq {
+			break
+		}
+		y := spectrogramRow(f, maxFreq)
+		for x := spectrogramMarginLeft - 6; x < spectrogramMarginLeft; x++ {
+			img.SetRGBA(x, y, black)
+		}
+		label := fmt.Sprintf("%.0f", f)
+		if f >= 1000 {
+			label = fmt.Sprintf("%.0fk", f/1000)
+		}
+		drawLabel(img, label, 4, y+4)
+	}
+	drawLabel(img, "colour", 4, spectrogramHeight+spectrogramStripHeight/2+4)
+
+	// Time axis labels at the start and end of the recorded chunks, the
+	// start is later than 0s once older chunks have been discarded
+	startTime, endTime := s.timeRange()
+	drawLabel(img, fmt.Sprintf("%.1fs", startTime), spectrogramMarginLeft, height-5)
+	end := fmt.Sprintf("%.1fs", endTime)
+	drawLabel(img, end, width-7*len(end), height-5)
+
+	return img
+}
+
+// Draws a label onto the image with its baseline starting at x, y
+func drawLabel(img *image.RGBA, label string, x, y int) {
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.Black,
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(label)
+}
+
+// Renders the recorded spectrogram to a png file
+func createSpectrogram(s *spectrogramRecorder, filename string) error {
+	img := s.render()
+	if img == nil {
+		return nil
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, img); err != nil {
+		return err
+	}
+
+	return nil
+}
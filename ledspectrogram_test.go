@@ -0,0 +1,117 @@
+package lcv
+
+import (
+	"math"
+	"testing"
+)
+
+// Records n chunks, the i-th of which has frequency i and every bin i
+func recordChunks(s *spectrogramRecorder, from, n, bins int) {
+	for i := from; i < from+n; i++ {
+		spectrum := make([]complex64, bins)
+		for j := range spectrum {
+			spectrum[j] = complex(float32(i), 0)
+		}
+		s.add(spectrum, i, uint32(i))
+	}
+}
+
+// Returns the frequencies of the recorded chunks from the oldest, checking
+// the spectra and colours are kept with them
+func recordedFreqs(t *testing.T, s *spectrogramRecorder) []int {
+	t.Helper()
+	freqs := make([]int, s.filled)
+	for i := range freqs {
+		freqs[i] = s.freqs[s.index(i)]
+		if mag := s.spectra[s.index(i)]; mag[0] != float32(freqs[i]) || s.colours[s.index(i)] != uint32(freqs[i]) {
+			t.Fatalf("chunk %d has the frequency %d, the level %g and the colour %d", i, freqs[i], mag[0], s.colours[s.index(i)])
+		}
+	}
+	return freqs
+}
+
+func TestSpectrogramRing(t *testing.T) {
+	tests := []struct {
+		chunks int
+		want   []int
+	}{
+		{0, []int{}},
+		{3, []int{0, 1, 2}},
+		{5, []int{0, 1, 2, 3, 4}},
+		{6, []int{1, 2, 3, 4, 5}},
+		{13, []int{8, 9, 10, 11, 12}},
+	}
+
+	for _, tt := range tests {
+		s := newSpectrogramRecorder(5, 10, 20)
+		recordChunks(s, 0, tt.chunks, 4)
+		got := recordedFreqs(t, s)
+		if len(got) != len(tt.want) {
+			t.Errorf("after %d chunks kept %v, want %v", tt.chunks, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("after %d chunks kept %v, want %v", tt.chunks, got, tt.want)
+				break
+			}
+		}
+
+		// The time range covers the chunks which are kept
+		start, end := s.timeRange()
+		wantStart, wantEnd := float64(tt.chunks-len(tt.want))/20, float64(tt.chunks)/20
+		if math.Abs(start-wantStart) > 1e-9 || math.Abs(end-wantEnd) > 1e-9 {
+			t.Errorf("after %d chunks the time range is %gs to %gs, want %gs to %gs", tt.chunks, start, end, wantStart, wantEnd)
+		}
+	}
+}
+
+func TestSpectrogramRender(t *testing.T) {
+	s := newSpectrogramRecorder(100, 10, 20)
+	if img := s.render(); img != nil {
+		t.Errorf("an empty recording rendered a %v image", img.Bounds())
+	}
+
+	// The image has a column for each chunk which is kept
+	for _, chunks := range []int{1, 40, 250} {
+		s := newSpectrogramRecorder(100, 10, 20)
+		recordChunks(s, 1, chunks, 512)
+		img := s.render()
+		want := spectrogramMarginLeft + s.filled
+		if img == nil || img.Bounds().Dx() != want {
+			t.Errorf("%d chunks rendered %v, want a width of %d", chunks, img, want)
+			continue
+		}
+		if h := img.Bounds().Dy(); h != spectrogramHeight+spectrogramStripHeight+spectrogramMarginBottom {
+			t.Errorf("%d chunks rendered a height of %d", chunks, h)
+		}
+
+		// The strip shows the colour of each chunk
+		c := img.RGBAAt(img.Bounds().Dx()-1, spectrogramHeight+1)
+		last := uint32(chunks)
+		if c.R != uint8(last>>16) || c.G != uint8(last>>8) || c.B != uint8(last) {
+			t.Errorf("%d chunks end with the colour %v, want %#06x", chunks, c, last)
+		}
+	}
+}
+
+func TestSpectrogramRow(t *testing.T) {
+	const maxFreq = 5120
+	if got := spectrogramRow(spectrogramMinFreq, maxFreq); got != spectrogramHeight-1 {
+		t.Errorf("%d Hz is on row %d, want the bottom row %d", spectrogramMinFreq, got, spectrogramHeight-1)
+	}
+	if got := spectrogramRow(maxFreq, maxFreq); got != 0 {
+		t.Errorf("%d Hz is on row %d, want the top row", maxFreq, got)
+	}
+
+	// The rows are spaced logarithmically, so each octave covers the same
+	// number of rows, 8 octaves from 20 Hz to 5120 Hz
+	prev := spectrogramRow(spectrogramMinFreq, maxFreq)
+	for f := 2.0 * spectrogramMinFreq; f <= maxFreq; f *= 2 {
+		row := spectrogramRow(f, maxFreq)
+		if d := prev - row; d < 63 || d > 64 {
+			t.Errorf("the octave up to %g Hz covers %d rows, want 63.875", f, d)
+		}
+		prev = row
+	}
+}
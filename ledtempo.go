@@ -0,0 +1,253 @@
+package lcv
+
+import (
+	"math"
+	"math/cmplx"
+	"sync"
+)
+
+const (
+	// The slowest and fastest tempos the tracker will report
+	minBPM = 60.0
+	maxBPM = 200.0
+	// The tempo the tracker leans towards when two tempos are equally likely,
+	// this stops it flipping between half and double time
+	preferredBPM = 120.0
+	// The number of seconds of onset strength the tempo is estimated over
+	tempoWindow = 8.0
+	// The number of audio chunks between each tempo estimation
+	tempoUpdateInterval = 8
+)
+
+// Estimates the tempo and beat phase of the audio stream from the onset
+// strength envelope of the audio chunks
+type tempoTracker struct {
+	// The number of audio chunks analysed per second
+	frameRate float64
+	// The log compressed magnitude spectrum of the previous audio chunk,
+	// used to calculate the spectral flux
+	prevMag []float64
+	// Ring buffer holding the onset strength of the last few seconds
+	onsets []float64
+	// Counter for onsets used to update it without shifting, works the
+	// same as the counter used for damping
+	c int
+	// The number of onset values which have been written, capped at the
+	// length of onsets
+	filled int
+	// The number of audio chunks since the tempo was last estimated
+	sinceUpdate int
+
+	// Lock guarding the estimation results below which are read by the ui
+	mu sync.Mutex
+	// The current tempo estimate in beats per minute, 0 if unknown
+	bpm float64
+	// The length of a beat measured in audio chunks
+	period float64
+	// The number of audio chunks since the last beat
+	sinceBeat float64
+	// The number of beats since the tracker was reset, its fraction is the
+	// beat phase once a tempo has been found
+	beatCount float64
+}
+
+// Generates a new tempo tracker, reset must be called with the frame rate
+// before the tracker is updated
+func newTempoTracker() *tempoTracker {
+	return &tempoTracker{}
+}
+
+// Clears the tracker's history and prepares it for a stream producing
+// frameRate audio chunks per second
+func (t *tempoTracker) reset(frameRate float64) {
+	t.frameRate = frameRate
+	t.prevMag = nil
+	t.onsets = make([]float64, int(tempoWindow*frameRate))
+	t.c = 0
+	t.filled = 0
+	t.sinceUpdate = 0
+
+	t.mu.Lock()
+	t.bpm = 0
+	t.period = 0
+	t.sinceBeat = 0
+	t.beatCount = 0
+	t.mu.Unlock()
+}
+
+// Adds the spectrum of the latest audio chunk to the onset envelope and
+// re-estimates the tempo every few chunks
+func (t *tempoTracker) update(spectrum []complex64) {
+	if len(t.onsets) == 0 {
+		return
+	}
+
+	// The spectral flux is the sum of the increases in magnitude across all
+	// bins, the magnitude is log compressed so quiet onsets still register
+	if len(t.prevMag) != len(spectrum) {
+		t.prevMag = make([]float64, len(spectrum))
+	}
+	var flux float64
+	for i, v := range spectrum {
+		m := math.Log1p(cmplx.Abs(complex128(v)))
+		if d := m - t.prevMag[i]; d > 0 {
+			flux += d
+		}
+		t.prevMag[i] = m
+	}
+
+	t.onsets[t.c] = flux
+	t.c = (t.c + 1) % len(t.onsets)
+	if t.filled < len(t.onsets) {
+		t.filled++
+	}
+
+	// The beat phase advances every chunk, the estimation corrects it. The
+	// beats pass at the preferred tempo until a tempo is found
+	t.mu.Lock()
+	if t.period > 0 {
+		t.sinceBeat = math.Mod(t.sinceBeat+1, t.period)
+		t.beatCount += 1 / t.period
+	} else {
+		t.beatCount += preferredBPM / 60 / t.frameRate
+	}
+	t.mu.Unlock()
+
+	t.sinceUpdate++
+	if t.sinceUpdate >= tempoUpdateInterval {
+		t.sinceUpdate = 0
+		t.estimate()
+	}
+}
+
+// Returns the onset envelope in chronological order with its mean removed.
+// The envelope is lightly smoothed so beat periods which are not a whole
+// number of audio chunks still correlate with their neighbouring lags
+func (t *tempoTracker) envelope() []float64 {
+	raw := make([]float64, t.filled)
+	start := (t.c - t.filled + len(t.onsets)) % len(t.onsets)
+	for i := range raw {
+		raw[i] = t.onsets[(start+i)%len(t.onsets)]
+	}
+
+	env := make([]float64, len(raw))
+	var mean float64
+	for i := range raw {
+		env[i] = 0.5 * raw[i]
+		if i > 0 {
+			env[i] += 0.25 * raw[i-1]
+		}
+		if i < len(raw)-1 {
+			env[i] += 0.25 * raw[i+1]
+		}
+		mean += env[i]
+	}
+	mean /= float64(len(env))
+	for i := range env {
+		env[i] -= mean
+	}
+
+	return env
+}
+
+// Estimates the tempo from the autocorrelation of the onset envelope and the
+// beat phase from the onsets which line up with the estimated beat period
+func (t *tempoTracker) estimate() {
+	minLag := int(math.Floor(60 * t.frameRate / maxBPM))
+	maxLag := int(math.Ceil(60 * t.frameRate / minBPM))
+	if minLag < 1 {
+		minLag = 1
+	}
+	// At least two beats of the slowest tempo are needed for an estimate
+	if t.filled < 2*maxLag {
+		return
+	}
+	env := t.envelope()
+
+	// Autocorrelation of the envelope for every lag in the tempo range, the
+	// lag is one wider on each side so the peak can be interpolated
+	acf := make([]float64, maxLag+2)
+	for lag := minLag - 1; lag <= maxLag+1; lag++ {
+		if lag < 1 {
+			continue
+		}
+		var sum float64
+		for i := lag; i < len(env); i++ {
+			sum += env[i] * env[i-lag]
+		}
+		acf[lag] = sum / float64(len(env)-lag)
+	}
+
+	// The peak is weighted by a log-gaussian around the preferred tempo
+	preferredLag := 60 * t.frameRate / preferredBPM
+	best := 0
+	var bestScore float64
+	for lag := minLag; lag <= maxLag; lag++ {
+		w := math.Exp(-0.5 * math.Pow(math.Log2(float64(lag)/preferredLag), 2))
+		if s := acf[lag] * w; s > bestScore {
+			bestScore = s
+			best = lag
+		}
+	}
+	if best == 0 {
+		return
+	}
+
+	// Parabolic interpolation around the peak gives a sub-chunk beat period
+	period := float64(best)
+	if best > 1 {
+		a, b, c := acf[best-1], acf[best], acf[best+1]
+		if d := a - 2*b + c; d < 0 {
+			period += 0.5 * (a - c) / d
+		}
+	}
+
+	// The phase is the offset from the newest chunk whose comb of beats
+	// lines up with the most onset energy
+	var phase int
+	var phaseScore = math.Inf(-1)
+	for off := 0; off < int(period+0.5); off++ {
+		var sum float64
+		for k := 0.0; ; k++ {
+			i := len(env) - 1 - off - int(k*period+0.5)
+			if i < 0 {
+				break
+			}
+			sum += env[i]
+		}
+		if sum > phaseScore {
+			phaseScore = sum
+			phase = off
+		}
+	}
+
+	t.mu.Lock()
+	t.period = period
+	t.bpm = 60 * t.frameRate / period
+	t.sinceBeat = float64(phase)
+	// The count moves to the nearest count with the new phase, so it stays
+	// on the beat without jumping a whole beat
+	t.beatCount += math.Remainder(t.sinceBeat/t.period-t.beatCount, 1)
+	t.mu.Unlock()
+}
+
+// Returns the estimated tempo in beats per minute and the position within the
+// current beat in the range [0, 1), both are 0 if no tempo has been found yet
+func (t *tempoTracker) tempo() (bpm float64, phase float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.period == 0 {
+		return 0, 0
+	}
+	return t.bpm, t.sinceBeat / t.period
+}
+
+// Returns the number of beats since the tracker was reset, which follows the
+// estimated tempo and phase once they are found
+func (t *tempoTracker) beats() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.beatCount
+}
@@ -0,0 +1,75 @@
+package lcv
+
+import (
+	"github.com/nadav-rahimi/led-colour-visualiser/fftsingle"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Returns a click track at bpm, each click a short burst of decaying noise
+// over quiet noise, starting offset seconds in
+func clickTrack(bpm, offset, seconds, rate float64) []float32 {
+	r := rand.New(rand.NewSource(1))
+	x := make([]float32, int(seconds*rate))
+	for i := range x {
+		x[i] = float32(0.01 * r.NormFloat64())
+	}
+	for beat := offset; beat < seconds; beat += 60 / bpm {
+		start := int(beat * rate)
+		for i := 0; i < int(0.02*rate) && start+i < len(x); i++ {
+			x[start+i] += float32(r.NormFloat64() * math.Exp(-float64(i)/(0.004*rate)))
+		}
+	}
+	return x
+}
+
+func TestTempoClickTrack(t *testing.T) {
+	const rate, chunk, seconds = 44100.0, 1024, 12.0
+	frameRate := rate / chunk
+
+	for _, bpm := range []float64{90, 120, 128, 150} {
+		offset := 0.13
+		x := clickTrack(bpm, offset, seconds, rate)
+
+		tt := newTempoTracker()
+		tt.reset(frameRate)
+		n := len(x) / chunk
+		for i := 0; i < n; i++ {
+			spectrum := fftsingle.RealSpectrum(x[i*chunk:(i+1)*chunk], nil, 0)
+			tt.update(spectrum[:chunk/2])
+		}
+
+		got, phase := tt.tempo()
+		if math.Abs(got-bpm)/bpm > 0.02 {
+			t.Errorf("%g bpm: estimated %.1f bpm", bpm, got)
+			continue
+		}
+
+		// The phase is how far the end of the last chunk is past the last click
+		end := float64(n*chunk) / rate
+		beats := (end - offset) * bpm / 60
+		want := beats - math.Floor(beats)
+		if d := math.Abs(math.Remainder(phase-want, 1)); d > 0.1 {
+			t.Errorf("%g bpm: beat phase %.2f, want %.2f", bpm, phase, want)
+		}
+		if d := math.Abs(math.Remainder(tt.beats()-phase, 1)); d > 1e-9 {
+			t.Errorf("%g bpm: beat count %.2f is not at the beat phase %.2f", bpm, tt.beats(), phase)
+		}
+	}
+}
+
+func TestTempoSilence(t *testing.T) {
+	tt := newTempoTracker()
+	tt.reset(44100.0 / 1024)
+	for i := 0; i < 600; i++ {
+		tt.update(make([]complex64, 512))
+	}
+	if bpm, phase := tt.tempo(); bpm != 0 || phase != 0 {
+		t.Errorf("silence gave %.1f bpm at phase %.2f, want no tempo", bpm, phase)
+	}
+	// The beats still pass at the preferred tempo for beat animations
+	if want := 600 / (44100.0 / 1024) * preferredBPM / 60; math.Abs(tt.beats()-want) > 1e-6 {
+		t.Errorf("silence counted %.2f beats, want %.2f", tt.beats(), want)
+	}
+}
@@ -1,11 +1,8 @@
 package lcv
 
 import (
-	"fmt"
-	"math/rand"
 	"net"
 	"strings"
-	"time"
 )
 
 // UDP Client
@@ -19,35 +16,46 @@ type udpC struct {
 	udpconn *net.UDPConn
 }
 
-// Generates a new udp client at localhost with the specified port number
-func newUdpC(port string) *udpC {
-	var client = &udpC{
-		host: "127.0.0.1:",
-		port: port,
+// The address of the udp server the colours are sent to by default
+const defaultOutputAddress = "127.0.0.1:6969"
+
+// Generates a new udp client for an address of the form "host:port"
+func newUdpCAddress(address string) (*udpC, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
 	}
-	return client
+
+	return &udpC{
+		host: host + ":",
+		port: port,
+	}, nil
 }
 
 // Starts the udp client on the specified host and port
-func (c *udpC) start() {
+func (c *udpC) start() error {
 	var err error
 	c.udpaddr, err = net.ResolveUDPAddr("udp4", c.host+c.port)
+	if err != nil {
+		return err
+	}
 	c.udpconn, err = net.DialUDP("udp4", nil, c.udpaddr)
-	chk(err)
+	if err != nil {
+		return err
+	}
 
-	fmt.Printf("The UDP server is %s\n", c.udpconn.RemoteAddr().String())
+	return nil
 }
 
 // Sends a string message on the udp client
-func (c *udpC) sendMsg(m string) {
+func (c *udpC) sendMsg(m string) error {
 	data := []byte(m + "\n")
-	_, err := c.udpconn.Write(data) // write to buffer and then exit the client after notifying server of shutdown#
-	// Find a way to close the connection
+	_, err := c.udpconn.Write(data)
+	// The server may already be gone when it is told to stop
 	if strings.TrimSpace(string(data)) == "STOP" {
-		fmt.Println("Exiting UDP client!")
-		return
+		return nil
 	}
-	chk(err)
+	return err
 }
 
 // Closes the connection of the client to the specified host and port
@@ -55,46 +63,62 @@ func (c *udpC) closeConnection() {
 	c.udpconn.Close()
 }
 
-// UDP Server used for testing
-type udpS struct {
-	// the port to run the server on
+// UDP server which logs the colours it receives, used for testing the
+// outputs without led lights
+type UDPServer struct {
+	// the address to run the server on
 	port string
 	// the udp endpoint address, contains IP and port information
 	udpaddr *net.UDPAddr
 	// the udp connection
 	udpconn *net.UDPConn
+	// The logger the received messages are written to at the info level,
+	// nil discards them
+	Log *Logger
 }
 
-// Generates a new server object
-func NewUdpS() *udpS {
-	var client = &udpS{
-		port: "127.0.0.1:6969",
+// Generates a new server object listening on an address of the form
+// "host:port", the default output address is used if it is empty
+func NewUDPServer(address string) *UDPServer {
+	if address == "" {
+		address = defaultOutputAddress
 	}
-	return client
+	var server = &UDPServer{
+		port: address,
+		Log:  DefaultLogger(),
+	}
+	return server
 }
 
-// Runs the server to print all messages it receives from the client
-func (s *udpS) Run() {
+// Runs the server to log all messages it receives from the client until it
+// receives "STOP" or reading fails
+func (s *UDPServer) Run() error {
 	var err error
 	s.udpaddr, err = net.ResolveUDPAddr("udp4", s.port) // Gets the udp endpoint address
-	chk(err)
+	if err != nil {
+		return err
+	}
 	s.udpconn, err = net.ListenUDP("udp4", s.udpaddr) // Listen for a connection from a udp client
-	chk(err)
+	if err != nil {
+		return err
+	}
 
 	defer s.udpconn.Close()
+	s.Log.Info("listening for colours", "address", s.udpaddr)
 	buffer := make([]byte, 1024)
-	rand.Seed(time.Now().Unix())
 
 	for {
-		n, _, err := s.udpconn.ReadFromUDP(buffer)
-		// n is the number of bytes read from the buffer, we minus 1 to compensate for the newline which the client writes
-		fmt.Print("-> ", string(buffer[0:n-1]), "\n")
-
-		if strings.TrimSpace(string(buffer[0:n])) == "STOP" {
-			fmt.Println("Exiting UDP server!")
-			return
+		n, addr, err := s.udpconn.ReadFromUDP(buffer)
+		if err != nil {
+			return err
 		}
+		// n is the number of bytes read from the buffer, the newline which the client writes is trimmed
+		msg := strings.TrimSpace(string(buffer[0:n]))
+		s.Log.Info("received", "from", addr, "msg", msg)
 
-		chk(err)
+		if msg == "STOP" {
+			s.Log.Info("stopping the server")
+			return nil
+		}
 	}
 }
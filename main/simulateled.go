@@ -1,11 +1,40 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"github.com/andlabs/ui"
 	"github.com/nadav-rahimi/led-colour-visualiser"
+	"github.com/nadav-rahimi/led-colour-visualiser/gui"
+	"os"
 )
 
 // Main
 func main() {
-	_ = ui.Main(lcv.SetupUI)
+	flag.StringVar(&gui.ConfigPath, "config", gui.ConfigPath, "json config file the settings are loaded from and saved to instead of the saved gui state")
+	flag.StringVar(&gui.StatePath, "state", gui.StatePath, "file the gui state is saved to, the user's config directory is used if empty")
+	flag.StringVar(&gui.PresetDir, "presets", gui.PresetDir, "directory the presets are stored in, the user's config directory is used if empty")
+	flag.StringVar(&gui.GradientDir, "gradients", gui.GradientDir, "directory of the user gradients, the user's config directory is used if empty")
+	flag.StringVar(&gui.MetricsAddr, "metrics", gui.MetricsAddr, "address such as localhost:9100 to serve the analyser's metrics on at /debug/vars, disabled if empty")
+	logLevel := lcv.LevelInfo
+	flag.Var(&logLevel, "log-level", "lowest level logged: debug, info, warn, error or off")
+	logFrames := flag.Int("log-frames", 0, "log every nth analysed frame at the debug level, 0 disables the frame logs")
+	logFile := flag.String("log", "", "file the log is written to instead of stderr")
+	flag.Parse()
+
+	// Logging
+	logger := lcv.DefaultLogger()
+	logger.SetLevel(logLevel)
+	logger.SetFrameSampling(*logFrames)
+	if *logFile != "" {
+		f, err := os.OpenFile(*logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Opening the log:", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		logger.SetOutput(f)
+	}
+
+	_ = ui.Main(gui.SetupUI)
 }